@@ -2,8 +2,8 @@ import * as Location from 'expo-location';
 import { createContext, useContext, useEffect, useState } from 'react';
 
 export const LocationContext = createContext<{
-  userLocation: { lat: number; lon: number };
-  setUserLocation: (location: { lat: number; lon: number }) => void;
+  userLocation: { lat: number; lon: number; altitude?: number };
+  setUserLocation: (location: { lat: number; lon: number; altitude?: number }) => void;
   isLoadingLocation: boolean;
   hasLocation: boolean | undefined;
   isPermissionDenied: boolean;
@@ -23,6 +23,7 @@ export function LocationContextProvider({
   const [userLocation, setUserLocation] = useState<{
     lat: number;
     lon: number;
+    altitude?: number;
   }>({
     lat: 0,
     lon: 0,
@@ -59,6 +60,7 @@ export function LocationContextProvider({
         setUserLocation({
           lat: location.coords.latitude,
           lon: location.coords.longitude,
+          altitude: location.coords.altitude ?? undefined,
         });
       } catch {
         setHasLocation(false);
@@ -118,13 +118,15 @@ export const SeshContextProvider = ({
                       lat: location.coords.latitude,
                       lon: location.coords.longitude,
                     };
-                    setUserLocation(freshCoords);
+                    const altitude = location.coords.altitude ?? undefined;
+                    setUserLocation({ ...freshCoords, altitude });
                     try {
                       if (!isConnected) {
                         await startOfflineSession({
                           is_public: true,
                           location: { coordinates: freshCoords },
                           coords: freshCoords,
+                          altitude,
                           bristol_score: 0,
                           started: new Date(),
                           company_time: false,
@@ -135,6 +137,7 @@ export const SeshContextProvider = ({
                           is_public: true,
                           location: { coordinates: freshCoords },
                           coords: freshCoords,
+                          altitude,
                           bristol_score: 0,
                           started: new Date(),
                           company_time: false,
@@ -255,6 +258,7 @@ export const SeshContextProvider = ({
             lat: userLocation.lat,
             lon: userLocation.lon,
           },
+          altitude: userLocation.altitude,
           bristol_score: 0,
           started: new Date(),
           company_time: false,
@@ -274,6 +278,7 @@ export const SeshContextProvider = ({
           lat: userLocation.lat,
           lon: userLocation.lon,
         },
+        altitude: userLocation.altitude,
         bristol_score: 0,
         started: new Date(),
         company_time: false,
@@ -179,6 +179,7 @@ export type PoopCommentsRecord = {
 
 export type PoopSeshesRecord<Tlocation = unknown> = {
 	airplane?: boolean
+	altitude?: number
 	bristol_score?: number
 	city?: string | null
 	company_time?: boolean
@@ -25,6 +25,7 @@ export interface PoopSesh {
     lat: number;
     lon: number;
   };
+  altitude?: number;
   location?: {
     coordinates: {
       lat: number;
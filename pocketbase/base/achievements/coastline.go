@@ -0,0 +1,94 @@
+package achievements
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// landGeoJSON is a generalized outline of the continents and larger
+// islands. Along the beaches pinned in coastline_test.go it is up to about
+// 9km off the real coast: enough to tell a beach trip from a sesh in
+// Denver, not to settle whether a harbour counts.
+//
+//go:embed geodata/land.geojson
+var landGeoJSON []byte
+
+// embeddedCoastlineErrorMeters widens every radius checked against the
+// embedded outline, so a beach it places inland still counts. Points up to
+// this far inland may count as near the ocean too.
+const embeddedCoastlineErrorMeters = 12_000
+
+// CoastlineProvider answers geo feature queries offline from land polygons:
+// a point is near the ocean when it lies outside every land polygon or
+// within the radius of one's coastline.
+//
+// The polygons come from the embedded dataset or, when a path is given, from
+// a GeoJSON file of land polygons (e.g. Natural Earth's 10m land) for
+// coastline-accurate results. They are loaded on first use. Only a fallback
+// for deployments without a Mapbox token when the embedded outline is used.
+type CoastlineProvider struct {
+	path      string
+	tolerance float64 // added to every radius
+
+	once sync.Once
+	land []polygon
+	err  error
+}
+
+// NewCoastlineProvider returns a provider reading land polygons from path, or
+// from the embedded dataset when path is empty.
+func NewCoastlineProvider(path string) *CoastlineProvider {
+	if path == "" {
+		return &CoastlineProvider{tolerance: embeddedCoastlineErrorMeters}
+	}
+	return &CoastlineProvider{path: path}
+}
+
+func (c *CoastlineProvider) load() ([]polygon, error) {
+	c.once.Do(func() {
+		data := landGeoJSON
+		if c.path != "" {
+			data, c.err = os.ReadFile(c.path)
+			if c.err != nil {
+				return
+			}
+		}
+		c.land, c.err = parseGeoJSONPolygons(data)
+		if c.err == nil && len(c.land) == 0 {
+			c.err = fmt.Errorf("no land polygons found")
+		}
+		if c.err != nil && c.path != "" {
+			c.err = fmt.Errorf("loading coastline %s: %w", c.path, c.err)
+		}
+	})
+	return c.land, c.err
+}
+
+func (c *CoastlineProvider) NearOcean(lat, lon, radiusMeters float64) (bool, error) {
+	land, err := c.load()
+	if err != nil {
+		return false, err
+	}
+
+	p := latLon{Lat: lat, Lon: lon}
+	radiusMeters += c.tolerance
+	onLand := false
+	for _, poly := range land {
+		if poly.contains(p) {
+			onLand = true
+			break
+		}
+	}
+	if !onLand {
+		return true, nil
+	}
+
+	for _, poly := range land {
+		if poly.nearBounds(p, radiusMeters) && poly.boundaryDistance(p) <= radiusMeters {
+			return true, nil
+		}
+	}
+	return false, nil
+}
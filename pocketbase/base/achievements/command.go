@@ -0,0 +1,164 @@
+package achievements
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// NewCommand returns the `achievements` command with its `rescan`
+// subcommand. notify is called for every profile whose achievements changed,
+// except in a dry run, so the activity feed and webhooks see backfilled
+// grants. --no-notify only keeps the grants from queueing push
+// notifications.
+func NewCommand(app *pocketbase.PocketBase, notify ScanHandler) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "achievements",
+		Short: "Manage achievements",
+	}
+
+	command.AddCommand(newRescanCommand(app, notify))
+
+	return command
+}
+
+func newRescanCommand(app *pocketbase.PocketBase, notify ScanHandler) *cobra.Command {
+	var (
+		profileId     string
+		achievementId string
+		batchSize     int
+		dryRun        bool
+		noNotify      bool
+		revalidate    bool
+	)
+
+	command := &cobra.Command{
+		Use:   "rescan",
+		Short: "Re-evaluate achievements for existing profiles",
+		Long: "Re-evaluates achievements for every poo profile (or a single one) and grants\n" +
+			"the ones that are now earned, e.g. after adding or changing an achievement.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if batchSize < 1 {
+				return fmt.Errorf("--batch-size must be at least 1")
+			}
+
+			names, err := achievementNames(app)
+			if err != nil {
+				return err
+			}
+			if achievementId != "" {
+				if _, ok := names[achievementId]; !ok {
+					return fmt.Errorf("achievement %q not found or not active", achievementId)
+				}
+			}
+
+			handler := notify
+			if dryRun {
+				handler = nil
+			}
+
+			service := NewAchievementService(app)
+			opts := ScanOptions{AchievementId: achievementId, DryRun: dryRun, Revalidate: revalidate, Quiet: noNotify}
+			verb, revokeVerb := "granted", "revoked"
+			if dryRun {
+				verb, revokeVerb = "would grant", "would revoke"
+			}
+
+			var scanned, granted, revoked, failed int
+			err = eachProfileBatch(app, profileId, batchSize, func(profiles []*core.Record) {
+				for _, profile := range profiles {
+					result, err := service.ScanWithOptions(profile.Id, opts)
+					scanned++
+					if err != nil {
+						failed++
+						cmd.PrintErrf("Error scanning profile %s: %v\n", profile.Id, err)
+						continue
+					}
+					for _, grant := range result.Grants {
+						granted++
+						name := names[grant.AchievementId]
+						switch {
+						case grant.Upgrade:
+							cmd.Printf("%s %q upgrade to %s to %s (%s)\n", verb, name, grant.TierName, profile.GetString("codeName"), profile.Id)
+						case grant.TierName != "":
+							cmd.Printf("%s %q (%s) to %s (%s)\n", verb, name, grant.TierName, profile.GetString("codeName"), profile.Id)
+						default:
+							cmd.Printf("%s %q to %s (%s)\n", verb, name, profile.GetString("codeName"), profile.Id)
+						}
+					}
+					for _, revocation := range result.Revoked {
+						revoked++
+						cmd.Printf("%s %q from %s (%s): %s\n", revokeVerb, names[revocation.AchievementId],
+							profile.GetString("codeName"), profile.Id, revocation.Reason)
+					}
+					if handler != nil && (len(result.Grants) > 0 || len(result.Revoked) > 0) {
+						handler(profile.Id, result)
+					}
+				}
+				cmd.Printf("Scanned %d profiles...\n", scanned)
+			})
+			if err != nil {
+				return err
+			}
+
+			cmd.Printf("Done: %d profiles scanned, %d achievements %s, %d %s, %d errors\n", scanned, granted, verb, revoked, revokeVerb, failed)
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&profileId, "profile", "", "only rescan this poo profile id")
+	command.Flags().StringVar(&achievementId, "achievement", "", "only evaluate this achievement id")
+	command.Flags().IntVar(&batchSize, "batch-size", 100, "number of profiles loaded per batch")
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "report who would earn what without granting anything")
+	command.Flags().BoolVar(&noNotify, "no-notify", false, "do not send push notifications for granted achievements (activity and webhooks still get them)")
+	command.Flags().BoolVar(&revalidate, "revalidate", false, "also revoke revocable achievements profiles no longer qualify for")
+
+	return command
+}
+
+// achievementNames maps the ids of active achievements to their names.
+func achievementNames(app core.App) (map[string]string, error) {
+	records, err := app.FindAllRecords("achievements", dbx.HashExp{"active": true})
+	if err != nil {
+		return nil, fmt.Errorf("getting achievements: %w", err)
+	}
+	names := make(map[string]string, len(records))
+	for _, r := range records {
+		names[r.Id] = r.GetString("name")
+	}
+	return names, nil
+}
+
+// eachProfileBatch calls fn with the poo profiles in id order, batchSize at a
+// time, or once with the single profile when profileId is set.
+func eachProfileBatch(app core.App, profileId string, batchSize int, fn func([]*core.Record)) error {
+	if profileId != "" {
+		profile, err := app.FindRecordById("poo_profiles", profileId)
+		if err != nil {
+			return fmt.Errorf("getting profile %s: %w", profileId, err)
+		}
+		fn([]*core.Record{profile})
+		return nil
+	}
+
+	lastId := ""
+	for {
+		profiles, err := app.FindRecordsByFilter(
+			"poo_profiles", "id > {:lastId}", "id", batchSize, 0,
+			dbx.Params{"lastId": lastId},
+		)
+		if err != nil {
+			return fmt.Errorf("getting profiles: %w", err)
+		}
+		if len(profiles) == 0 {
+			return nil
+		}
+		fn(profiles)
+		lastId = profiles[len(profiles)-1].Id
+	}
+}
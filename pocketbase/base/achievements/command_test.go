@@ -0,0 +1,142 @@
+package achievements
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// rescanTest is an app with two profiles that have earned "First Sesh" but
+// were never scanned. It records the handler calls and whether each grant
+// was saved quietly.
+type rescanTest struct {
+	app      *pocketbase.PocketBase
+	profiles []*core.Record
+	first    *core.Record
+
+	mu      sync.Mutex
+	handled []string // profile ids
+	quiet   []bool   // per saved grant
+}
+
+func newRescanTest(t *testing.T) *rescanTest {
+	app := apptest.NewApp(t)
+	rt := &rescanTest{app: app}
+	for _, codeName := range []string{"alpha", "bravo"} {
+		profile := apptest.NewProfile(t, app, codeName, nil)
+		addSeshes(t, app, profile, sesh{started: time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)})
+		rt.profiles = append(rt.profiles, profile)
+	}
+	rt.first = newAchievement(t, app, "First Sesh", `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}`, nil)
+
+	app.OnRecordCreate("user_achievement").BindFunc(func(e *core.RecordEvent) error {
+		rt.mu.Lock()
+		rt.quiet = append(rt.quiet, IsQuiet(e.Context))
+		rt.mu.Unlock()
+		return e.Next()
+	})
+	return rt
+}
+
+// run executes `achievements rescan` with args and returns its output.
+func (rt *rescanTest) run(t *testing.T, args ...string) string {
+	t.Helper()
+	command := NewCommand(rt.app, func(poopProfileId string, result *ScanResult) {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		rt.handled = append(rt.handled, poopProfileId)
+	})
+	var out bytes.Buffer
+	command.SetOut(&out)
+	command.SetErr(&out)
+	command.SetArgs(append([]string{"rescan"}, args...))
+	if err := command.Execute(); err != nil {
+		t.Fatalf("rescan %v: %v\n%s", args, err, out.String())
+	}
+	return out.String()
+}
+
+func (rt *rescanTest) count(t *testing.T, collection string) int64 {
+	t.Helper()
+	n, err := rt.app.CountRecords(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRescanDryRunWritesNothing(t *testing.T) {
+	rt := newRescanTest(t)
+
+	out := rt.run(t, "--dry-run", "--revalidate")
+
+	if strings.Count(out, `would grant "First Sesh"`) != 2 || !strings.Contains(out, "Done: 2 profiles scanned, 2 achievements would grant") {
+		t.Errorf("output:\n%s\nwant two grants reported", out)
+	}
+	for _, collection := range []string{"user_achievement", "achievement_progress", "achievement_revocations"} {
+		if n := rt.count(t, collection); n != 0 {
+			t.Errorf("%d %s records after a dry run", n, collection)
+		}
+	}
+	if len(rt.handled) != 0 {
+		t.Errorf("published %v in a dry run", rt.handled)
+	}
+}
+
+func TestRescanNoNotifyOnlySilencesPush(t *testing.T) {
+	tests := []struct {
+		args  []string
+		quiet bool
+	}{
+		{nil, false},
+		{[]string{"--no-notify"}, true},
+	}
+	for _, tt := range tests {
+		rt := newRescanTest(t)
+		rt.run(t, tt.args...)
+
+		if n := rt.count(t, "user_achievement"); n != 2 {
+			t.Errorf("%v: %d grants, want 2", tt.args, n)
+		}
+		// The handler publishes to the activity feed and webhooks either way.
+		if len(rt.handled) != 2 {
+			t.Errorf("%v: published for %v, want both profiles", tt.args, rt.handled)
+		}
+		if len(rt.quiet) != 2 {
+			t.Errorf("%v: %d grants saved, want 2", tt.args, len(rt.quiet))
+		}
+		for _, quiet := range rt.quiet {
+			if quiet != tt.quiet {
+				t.Errorf("%v: grant saved quietly: %v, want %v", tt.args, quiet, tt.quiet)
+			}
+		}
+	}
+}
+
+func TestRescanOneProfile(t *testing.T) {
+	rt := newRescanTest(t)
+
+	out := rt.run(t, "--profile", rt.profiles[1].Id, "--achievement", rt.first.Id)
+
+	if !strings.Contains(out, "Done: 1 profiles scanned, 1 achievements granted") {
+		t.Errorf("output:\n%s\nwant one profile scanned", out)
+	}
+	if has, _ := NewAchievementService(rt.app).UserHasAchievement(rt.profiles[0].Id, rt.first.Id); has {
+		t.Error("rescanned a profile that was not asked for")
+	}
+
+	command := NewCommand(rt.app, nil)
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	command.SetArgs([]string{"rescan", "--achievement", "nope"})
+	if err := command.Execute(); err == nil {
+		t.Error("want an error for an unknown achievement")
+	}
+}
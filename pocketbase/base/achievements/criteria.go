@@ -0,0 +1,266 @@
+package achievements
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Group operators for criteria tree nodes.
+const (
+	GroupAll  = "all"  // every child must match
+	GroupAny  = "any"  // at least one child must match
+	GroupNone = "none" // no child may match
+)
+
+// maxCriteriaDepth bounds how deeply groups may be nested.
+const maxCriteriaDepth = 8
+
+// conditionTypeAliases maps alternative leaf condition type names to the
+// evaluator they are handled by.
+var conditionTypeAliases = map[string]string{
+	"ocean_proximity": "geo_proximity",
+}
+
+// CriteriaNode is a single node of an achievement's criteria tree. A node is
+// either a group that combines its Children with all/any/none logic, or a leaf
+// holding one condition whose evaluator is picked by ConditionType.
+//
+// Example: 10 airplane seshes OR 5 seshes near the ocean, AND never on company
+// time:
+//
+//	{"all": [
+//	  {"any": [
+//	    {"conditionType": "aggregate", "aggregation": "count", "filter": "is_airplane = true", "operator": "greater_than_or_equal", "value": 10},
+//	    {"conditionType": "geo_proximity", "minCount": 5}
+//	  ]},
+//	  {"none": [{"conditionType": "simple", "field": "company_time", "operator": "equals", "value": true}]}
+//	]}
+//
+// The legacy flat format ({"type": ..., "conditions": [...]}) is also accepted
+// and decoded as an "all" group of leaves of that type. Legacy criteria
+// without conditions decode to an empty group, which never matches.
+type CriteriaNode struct {
+	Group    string
+	Children []*CriteriaNode
+
+	ConditionType string
+	Condition     any
+
+	legacy bool // decoded from the legacy flat format
+}
+
+// IsLeaf reports whether the node holds a single condition.
+func (n *CriteriaNode) IsLeaf() bool {
+	return n.Group == ""
+}
+
+// ParseCriteria decodes and validates the JSON stored in an achievement's
+// criteria field.
+func ParseCriteria(data []byte) (*CriteriaNode, error) {
+	var node CriteriaNode
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	if err := node.Validate(); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// UnmarshalJSON decodes a group, a leaf or a legacy flat criteria object.
+func (n *CriteriaNode) UnmarshalJSON(data []byte) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil || keys == nil {
+		return errors.New("criteria node must be an object")
+	}
+
+	if _, ok := keys["conditions"]; ok {
+		var legacy Criteria
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		node, err := legacy.toNode()
+		if err != nil {
+			return err
+		}
+		*n = *node
+		return nil
+	}
+
+	var group string
+	for _, g := range []string{GroupAll, GroupAny, GroupNone} {
+		if _, ok := keys[g]; !ok {
+			continue
+		}
+		if group != "" {
+			return fmt.Errorf("node cannot combine %q and %q", group, g)
+		}
+		group = g
+	}
+
+	if group == "" {
+		var head struct {
+			ConditionType string `json:"conditionType"`
+		}
+		if err := json.Unmarshal(data, &head); err != nil {
+			return err
+		}
+		if head.ConditionType == "" {
+			return errors.New("node must be a group (all/any/none) or have a conditionType")
+		}
+		return n.setLeaf(head.ConditionType, data)
+	}
+
+	if _, ok := keys["conditionType"]; ok {
+		return fmt.Errorf("%s group cannot have a conditionType", group)
+	}
+
+	var rawChildren []json.RawMessage
+	if err := json.Unmarshal(keys[group], &rawChildren); err != nil {
+		return fmt.Errorf("%s: %w", group, err)
+	}
+
+	children := make([]*CriteriaNode, 0, len(rawChildren))
+	for i, raw := range rawChildren {
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			return fmt.Errorf("%s[%d]: node cannot be null", group, i)
+		}
+		child := &CriteriaNode{}
+		if err := json.Unmarshal(raw, child); err != nil {
+			return fmt.Errorf("%s[%d]: %w", group, i, err)
+		}
+		children = append(children, child)
+	}
+
+	n.Group = group
+	n.Children = children
+	return nil
+}
+
+// setLeaf turns the node into a leaf, decoding raw into the condition struct
+// for conditionType.
+func (n *CriteriaNode) setLeaf(conditionType string, raw json.RawMessage) error {
+	if alias, ok := conditionTypeAliases[conditionType]; ok {
+		conditionType = alias
+	}
+	cond, err := decodeCondition(conditionType, raw)
+	if err != nil {
+		return err
+	}
+	n.ConditionType = conditionType
+	n.Condition = cond
+	return nil
+}
+
+// Validate checks the structure of the tree: groups must be non-empty, except
+// for legacy criteria without conditions, and nesting may not exceed
+// maxCriteriaDepth.
+func (n *CriteriaNode) Validate() error {
+	return n.validate(0)
+}
+
+func (n *CriteriaNode) validate(depth int) error {
+	if n.IsLeaf() {
+		if n.Condition == nil {
+			return errors.New("missing condition")
+		}
+		return nil
+	}
+
+	if depth >= maxCriteriaDepth {
+		return fmt.Errorf("groups nested deeper than %d levels", maxCriteriaDepth)
+	}
+	switch n.Group {
+	case GroupAll, GroupAny, GroupNone:
+	default:
+		return fmt.Errorf("unknown group %q", n.Group)
+	}
+	if len(n.Children) == 0 && !n.legacy {
+		return fmt.Errorf("%s group has no conditions", n.Group)
+	}
+
+	for i, child := range n.Children {
+		if err := child.validate(depth + 1); err != nil {
+			return fmt.Errorf("%s[%d]: %w", n.Group, i, err)
+		}
+	}
+	return nil
+}
+
+// decodeCondition decodes raw into the condition struct handled by the
+// evaluator for conditionType.
+func decodeCondition(conditionType string, raw json.RawMessage) (any, error) {
+	var (
+		cond any
+		err  error
+	)
+
+	switch conditionType {
+	case "simple":
+		var c Condition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "calculated":
+		var c CalculatedCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "aggregate":
+		var c AggregateCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "streak":
+		var c StreakCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "time_of_day":
+		var c TimeOfDayCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "geo_proximity":
+		var c GeoProximityCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "distinct_places":
+		var c DistinctPlacesCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "travel_distance":
+		var c TravelDistanceCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "geo_polygon":
+		var c GeoPolygonCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "home_distance":
+		var c HomeDistanceCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	case "altitude":
+		var c AltitudeCondition
+		err = json.Unmarshal(raw, &c)
+		cond = c
+	default:
+		return nil, fmt.Errorf("unknown condition type: %s", conditionType)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s condition: %w", conditionType, err)
+	}
+	return cond, nil
+}
+
+// toNode converts the legacy flat format into an "all" group of leaves.
+func (c Criteria) toNode() (*CriteriaNode, error) {
+	node := &CriteriaNode{Group: GroupAll, legacy: true}
+	for i, raw := range c.Conditions {
+		leaf := &CriteriaNode{}
+		if err := leaf.setLeaf(c.Type, raw); err != nil {
+			return nil, fmt.Errorf("conditions[%d]: %w", i, err)
+		}
+		node.Children = append(node.Children, leaf)
+	}
+	return node, nil
+}
@@ -0,0 +1,58 @@
+package achievements
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLegacyCriteria(t *testing.T) {
+	node := mustParseCriteria(t, `{"type": "aggregate", "conditions": [
+		{"aggregation": "count", "operator": "greater_than_or_equal", "value": 10},
+		{"aggregation": "count_distinct", "field": "city", "operator": "greater_than_or_equal", "value": 3}
+	]}`)
+	if node.Group != GroupAll || len(node.Children) != 2 {
+		t.Fatalf("got a %q group of %d, want all of 2", node.Group, len(node.Children))
+	}
+	for i, leaf := range node.Children {
+		if _, ok := leaf.Condition.(AggregateCondition); !ok || leaf.ConditionType != "aggregate" {
+			t.Errorf("conditions[%d] is a %s %T", i, leaf.ConditionType, leaf.Condition)
+		}
+	}
+
+	if _, err := ParseCriteria([]byte(`{"type": "nope", "conditions": [{}]}`)); err == nil {
+		t.Error("want an error for an unknown legacy type")
+	}
+}
+
+func TestEmptyLegacyCriteriaNeverMatch(t *testing.T) {
+	for _, criteria := range []string{
+		`{"type": "aggregate", "conditions": []}`,
+		`{"type": "simple", "conditions": null}`,
+		`{"type": "", "conditions": []}`,
+	} {
+		node, err := ParseCriteria([]byte(criteria))
+		if err != nil {
+			t.Errorf("%s: %v", criteria, err)
+			continue
+		}
+		progress, err := evaluateCriteria(newScanContext(nil, ""), node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress.Met {
+			t.Errorf("%s matched", criteria)
+		}
+	}
+}
+
+func TestEmptyGroupsAreRejected(t *testing.T) {
+	for _, criteria := range []string{
+		`{"all": []}`,
+		`{"any": [{"none": []}]}`,
+	} {
+		_, err := ParseCriteria([]byte(criteria))
+		if err == nil || !strings.Contains(err.Error(), "has no conditions") {
+			t.Errorf("%s: error %v, want an empty group error", criteria, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package achievements
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Eligibility holds an achievement's prerequisites. A profile that does not
+// meet them is not evaluated for the achievement at all.
+type Eligibility struct {
+	MinSeshes         int // minimum number of logged seshes
+	MinAccountAgeDays int // minimum days since the poo profile was created
+}
+
+// eligibilityFromRecord reads the eligibility fields of an achievement record.
+func eligibilityFromRecord(achievement *core.Record) Eligibility {
+	return Eligibility{
+		MinSeshes:         achievement.GetInt("min_seshes"),
+		MinAccountAgeDays: achievement.GetInt("min_account_age_days"),
+	}
+}
+
+// profileFacts are the per-profile values eligibility is checked against.
+type profileFacts struct {
+	SeshCount int
+	CreatedAt time.Time
+}
+
+// profileFacts reads the profile's creation date and counts its seshes. The
+// count shares its cache entry with unfiltered sesh count conditions.
+func (sc *scanContext) profileFacts() (profileFacts, error) {
+	profile, err := sc.profile()
+	if err != nil {
+		return profileFacts{}, fmt.Errorf("getting profile: %w", err)
+	}
+
+	seshCount, err := sc.aggregate(AggregateCondition{Table: "poop_seshes", Aggregation: "count"})
+	if err != nil {
+		return profileFacts{}, fmt.Errorf("counting seshes: %w", err)
+	}
+
+	return profileFacts{
+		SeshCount: int(seshCount.Value),
+		CreatedAt: profile.GetDateTime("created").Time(),
+	}, nil
+}
+
+// check reports whether the profile meets the prerequisites and, if not, why.
+func (e Eligibility) check(facts profileFacts, now time.Time) (bool, string) {
+	if facts.SeshCount < e.MinSeshes {
+		return false, fmt.Sprintf("has %d seshes (minimum %d)", facts.SeshCount, e.MinSeshes)
+	}
+	if e.MinAccountAgeDays > 0 {
+		ageDays := int(now.Sub(facts.CreatedAt).Hours() / 24)
+		if ageDays < e.MinAccountAgeDays {
+			return false, fmt.Sprintf("account is %d days old (minimum %d)", ageDays, e.MinAccountAgeDays)
+		}
+	}
+	return true, ""
+}
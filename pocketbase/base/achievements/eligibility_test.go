@@ -0,0 +1,52 @@
+package achievements
+
+import (
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+)
+
+func TestEligibilityCheck(t *testing.T) {
+	now := time.Date(2026, 6, 30, 12, 0, 0, 0, time.UTC)
+	facts := profileFacts{SeshCount: 3, CreatedAt: now.AddDate(0, 0, -10)}
+
+	tests := []struct {
+		name        string
+		eligibility Eligibility
+		want        bool
+	}{
+		{"no prerequisites", Eligibility{}, true},
+		{"enough seshes", Eligibility{MinSeshes: 3}, true},
+		{"too few seshes", Eligibility{MinSeshes: 4}, false},
+		{"old enough", Eligibility{MinAccountAgeDays: 10}, true},
+		{"too new", Eligibility{MinAccountAgeDays: 11}, false},
+	}
+	for _, tt := range tests {
+		ok, reason := tt.eligibility.check(facts, now)
+		if ok != tt.want || (reason == "") != tt.want {
+			t.Errorf("%s: eligible %v (%q), want %v", tt.name, ok, reason, tt.want)
+		}
+	}
+}
+
+func TestFirstSeshAchievement(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "rookie", nil)
+	addSeshes(t, app, profile, sesh{started: time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)})
+
+	criteria := `{"conditionType": "aggregate", "table": "poop_seshes", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}`
+	first := newAchievement(t, app, "First Sesh", criteria, nil)
+	gated := newAchievement(t, app, "Regular", criteria, map[string]any{"min_seshes": 10})
+
+	result, err := NewAchievementService(app).Scan(profile.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Earned) != 1 || result.Earned[0] != first.Id {
+		t.Errorf("earned %v, want only %s", result.Earned, first.Id)
+	}
+	if result.Stats.Ineligible != 1 {
+		t.Errorf("%d ineligible, want %s skipped", result.Stats.Ineligible, gated.Id)
+	}
+}
@@ -0,0 +1,69 @@
+package achievements
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// availableNowFilter matches achievements whose availability window, if any,
+// contains the current time.
+const availableNowFilter = "(available_from = '' || available_from <= @now) && (available_until = '' || available_until > @now)"
+
+// Event is a time-limited achievement, e.g. World Toilet Day.
+type Event struct {
+	AchievementId  string         `json:"achievementId"`
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	AvailableFrom  types.DateTime `json:"availableFrom"`
+	AvailableUntil types.DateTime `json:"availableUntil"`
+	Unlocked       bool           `json:"unlocked"`
+}
+
+// EventList groups the active events that have not ended yet.
+type EventList struct {
+	Running  []Event `json:"running"`
+	Upcoming []Event `json:"upcoming"`
+}
+
+// Events lists the running and upcoming events, i.e. active achievements with
+// an availability window that has not ended. Unlocked is set for the events
+// the profile already owns; poopProfileId may be empty.
+func (s *AchievementService) Events(poopProfileId string) (*EventList, error) {
+	records, err := s.app.FindRecordsByFilter(
+		"achievements",
+		"active = true && (available_from != '' || available_until != '') && (available_until = '' || available_until > @now)",
+		"available_from,available_until",
+		0,
+		0,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := map[string]*core.Record{}
+	if poopProfileId != "" {
+		if owned, err = newScanContext(s.app, poopProfileId).owned(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := types.NowDateTime()
+	list := &EventList{Running: []Event{}, Upcoming: []Event{}}
+	for _, record := range records {
+		_, unlocked := owned[record.Id]
+		event := Event{
+			AchievementId:  record.Id,
+			Name:           record.GetString("name"),
+			Description:    record.GetString("description"),
+			AvailableFrom:  record.GetDateTime("available_from"),
+			AvailableUntil: record.GetDateTime("available_until"),
+			Unlocked:       unlocked,
+		}
+		if event.AvailableFrom.After(now) {
+			list.Upcoming = append(list.Upcoming, event)
+		} else {
+			list.Running = append(list.Running, event)
+		}
+	}
+	return list, nil
+}
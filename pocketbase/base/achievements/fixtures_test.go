@@ -0,0 +1,83 @@
+package achievements
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// sesh describes a poop_seshes record to create. A zero ended leaves the sesh
+// open.
+type sesh struct {
+	started  time.Time
+	ended    time.Time
+	timezone string
+	fields   map[string]any
+}
+
+// addSeshes stores the seshes for profile in one transaction and returns
+// their records.
+func addSeshes(t testing.TB, app core.App, profile *core.Record, seshes ...sesh) []*core.Record {
+	t.Helper()
+	collection, err := app.FindCollectionByNameOrId("poop_seshes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make([]*core.Record, 0, len(seshes))
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, s := range seshes {
+			record := core.NewRecord(collection)
+			record.Set("user", profile.GetString("user"))
+			record.Set("poo_profile", profile.Id)
+			record.Set("started", s.started)
+			if !s.ended.IsZero() {
+				record.Set("ended", s.ended)
+			}
+			record.Set("timezone", s.timezone)
+			for name, value := range s.fields {
+				record.Set(name, value)
+			}
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// daily returns n seshes started a day apart from start.
+func daily(start time.Time, n int) []sesh {
+	seshes := make([]sesh, n)
+	for i := range seshes {
+		seshes[i] = sesh{started: start.AddDate(0, 0, i)}
+	}
+	return seshes
+}
+
+// newAchievement stores an active achievement with the given criteria JSON
+// and any further fields (tiers, min_seshes, revocable, ...).
+func newAchievement(t testing.TB, app core.App, name, criteria string, fields map[string]any) *core.Record {
+	t.Helper()
+	collection, err := app.FindCollectionByNameOrId("achievements")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("description", name)
+	record.Set("active", true)
+	record.Set("criteria", criteria)
+	for field, value := range fields {
+		record.Set(field, value)
+	}
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
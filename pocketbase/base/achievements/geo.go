@@ -0,0 +1,184 @@
+package achievements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GeoFeatureProvider answers questions about geographical features near a
+// point. Geo conditions call it once per sesh, through a cache shared by all
+// scans (see SetGeoFeatureProvider).
+type GeoFeatureProvider interface {
+	// NearOcean reports whether the point is within radiusMeters of the
+	// ocean.
+	NearOcean(lat, lon, radiusMeters float64) (bool, error)
+}
+
+var (
+	geoMu       sync.Mutex
+	geoProvider GeoFeatureProvider
+)
+
+// SetGeoFeatureProvider replaces the provider used by geo conditions. It is
+// wrapped in a result cache.
+func SetGeoFeatureProvider(provider GeoFeatureProvider) {
+	geoMu.Lock()
+	defer geoMu.Unlock()
+	geoProvider = newGeoCache(provider)
+}
+
+// geoFeatures returns the provider used by geo conditions, configuring it from
+// the environment on first use:
+//
+//   - MAPBOX_ACCESS_TOKEN: when set, geo conditions query Mapbox
+//   - GEO_PROVIDER: "coastline" uses the offline coastline even when a token
+//     is set; "mapbox" only warns when the token is missing
+//   - GEO_COASTLINE_FILE: GeoJSON land polygons replacing the embedded ones
+//
+// Without a token the offline coastline is used. Its embedded outline is
+// coarse, see CoastlineProvider.
+func geoFeatures() GeoFeatureProvider {
+	geoMu.Lock()
+	defer geoMu.Unlock()
+
+	if geoProvider == nil {
+		geoProvider = newGeoCache(defaultGeoFeatureProvider())
+	}
+	return geoProvider
+}
+
+func defaultGeoFeatureProvider() GeoFeatureProvider {
+	token := os.Getenv("MAPBOX_ACCESS_TOKEN")
+	switch name := os.Getenv("GEO_PROVIDER"); name {
+	case "", "mapbox":
+		if token != "" {
+			return NewMapboxProvider(token)
+		}
+		log.Printf("MAPBOX_ACCESS_TOKEN is not set, answering ocean proximity from the offline coastline")
+	case "coastline":
+	default:
+		if token != "" {
+			log.Printf("Unknown GEO_PROVIDER %q, using mapbox", name)
+			return NewMapboxProvider(token)
+		}
+		log.Printf("Unknown GEO_PROVIDER %q, using the offline coastline", name)
+	}
+	return NewCoastlineProvider(os.Getenv("GEO_COASTLINE_FILE"))
+}
+
+const (
+	// geoCachePrecision is the number of decimals coordinates are rounded to
+	// before lookup; 3 decimals is a cell of about 100m.
+	geoCachePrecision = 3
+	// geoCacheSize bounds the cache; it is cleared when full.
+	geoCacheSize = 100_000
+)
+
+// geoCache remembers provider answers by rounded coordinates, so a profile
+// logging from the same bathroom every day costs one lookup. Errors are not
+// cached.
+type geoCache struct {
+	provider GeoFeatureProvider
+
+	mu      sync.Mutex
+	entries map[string]bool
+}
+
+func newGeoCache(provider GeoFeatureProvider) *geoCache {
+	if cache, ok := provider.(*geoCache); ok {
+		return cache
+	}
+	return &geoCache{provider: provider, entries: make(map[string]bool)}
+}
+
+func (c *geoCache) NearOcean(lat, lon, radiusMeters float64) (bool, error) {
+	scale := math.Pow(10, geoCachePrecision)
+	lat, lon = math.Round(lat*scale)/scale, math.Round(lon*scale)/scale
+	key := fmt.Sprintf("ocean:%.*f,%.*f:%g", geoCachePrecision, lat, geoCachePrecision, lon, radiusMeters)
+
+	c.mu.Lock()
+	near, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return near, nil
+	}
+
+	near, err := c.provider.NearOcean(lat, lon, radiusMeters)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= geoCacheSize {
+		clear(c.entries)
+	}
+	c.entries[key] = near
+	c.mu.Unlock()
+	return near, nil
+}
+
+// MapboxProvider queries the Mapbox bathymetry tileset over HTTP. It is
+// precise but costs one request per uncached point.
+type MapboxProvider struct {
+	token   string
+	client  *http.Client
+	baseURL string
+}
+
+func NewMapboxProvider(token string) *MapboxProvider {
+	return &MapboxProvider{
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		baseURL: "https://api.mapbox.com",
+	}
+}
+
+// NearOcean returns true when the tile query finds at least one depth
+// feature within the radius. Errors never contain the request URL, which
+// carries the access token.
+func (m *MapboxProvider) NearOcean(lat, lon, radiusMeters float64) (bool, error) {
+	query := url.Values{
+		"radius":       {strconv.FormatFloat(radiusMeters, 'f', 0, 64)},
+		"limit":        {"1"},
+		"dedupe":       {"true"},
+		"layers":       {"depth"},
+		"access_token": {m.token},
+	}
+	// lon comes before lat in the Mapbox URL.
+	endpoint := fmt.Sprintf("%s/v4/mapbox.mapbox-bathymetry-v2/tilequery/%f,%f.json?%s",
+		m.baseURL, lon, lat, query.Encode())
+
+	resp, err := m.client.Get(endpoint)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return false, fmt.Errorf("mapbox request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("mapbox API status %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+
+	return len(result.Features) > 0, nil
+}
@@ -0,0 +1,194 @@
+package achievements
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type place struct {
+	name     string
+	lat, lon float64
+}
+
+// Beaches and waterfronts an ocean proximity achievement must accept.
+var beaches = []place{
+	{"Santa Monica", 34.0095, -118.4970},
+	{"Venice Beach", 33.9850, -118.4695},
+	{"Long Beach", 33.7607, -118.1893},
+	{"San Diego Pacific Beach", 32.7947, -117.2550},
+	{"Seattle waterfront", 47.6062, -122.3425},
+	{"English Bay", 49.2867, -123.1430},
+	{"Cape Cod", 41.6688, -70.2962},
+	{"Miami Beach", 25.7907, -80.1300},
+	{"Honolulu", 21.2760, -157.8270},
+	{"Copacabana", -22.9711, -43.1822},
+	{"Cascais", 38.6968, -9.4215},
+	{"Nice", 43.6950, 7.2650},
+	{"Cape Town", -33.9068, 18.4207},
+	{"Marine Drive", 18.9438, 72.8231},
+	{"Tokyo Bay", 35.6280, 139.7750},
+	{"Bondi", -33.8915, 151.2767},
+	{"Auckland", -36.8485, 174.7633},
+}
+
+// Places far from any ocean.
+var inland = []place{
+	{"Denver", 39.7392, -104.9903},
+	{"Kansas City", 39.0997, -94.5786},
+	{"Chicago", 41.8781, -87.6298},
+	{"Las Vegas", 36.1699, -115.1398},
+	{"Sacramento", 38.5816, -121.4944},
+	{"Brasília", -15.7939, -47.8828},
+	{"Madrid", 40.4168, -3.7038},
+	{"Paris", 48.8566, 2.3522},
+	{"Moscow", 55.7558, 37.6173},
+	{"Johannesburg", -26.2041, 28.0473},
+	{"Nairobi", -1.2921, 36.8219},
+	{"Delhi", 28.6139, 77.2090},
+	{"Ulaanbaatar", 47.8864, 106.9057},
+	{"Alice Springs", -23.6980, 133.8807},
+}
+
+func TestCoastlineNearOcean(t *testing.T) {
+	provider := NewCoastlineProvider("")
+
+	for _, p := range beaches {
+		near, err := provider.NearOcean(p.lat, p.lon, defaultGeoRadiusMeters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !near {
+			t.Errorf("%s: want near the ocean", p.name)
+		}
+	}
+	for _, p := range inland {
+		near, err := provider.NearOcean(p.lat, p.lon, defaultGeoRadiusMeters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if near {
+			t.Errorf("%s: want inland", p.name)
+		}
+	}
+}
+
+func TestCoastlineFileHasNoTolerance(t *testing.T) {
+	path := t.TempDir() + "/land.geojson"
+	// A square island around 0,0 about 222km across.
+	square := `{"type":"Polygon","coordinates":[[[-1,-1],[1,-1],[1,1],[-1,1],[-1,-1]]]}`
+	if err := os.WriteFile(path, []byte(square), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider := NewCoastlineProvider(path)
+
+	tests := []struct {
+		lat, lon float64
+		want     bool
+	}{
+		{0, 0, false},     // center, 111km from the coast
+		{0, 0.99, true},   // 1.1km from the coast
+		{0, 0.9, false},   // 11km from the coast
+		{0, 1.5, true},    // at sea
+		{0, -179.5, true}, // the antipode is at sea too
+	}
+	for _, tt := range tests {
+		near, err := provider.NearOcean(tt.lat, tt.lon, defaultGeoRadiusMeters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if near != tt.want {
+			t.Errorf("%v,%v: near = %v, want %v", tt.lat, tt.lon, near, tt.want)
+		}
+	}
+}
+
+func TestDefaultGeoFeatureProvider(t *testing.T) {
+	tests := []struct {
+		provider, token string
+		wantMapbox      bool
+	}{
+		{"", "pk.test", true},
+		{"", "", false},
+		{"mapbox", "pk.test", true},
+		{"mapbox", "", false},
+		{"coastline", "pk.test", false},
+		{"coastline", "", false},
+		{"bogus", "pk.test", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("GEO_PROVIDER", tt.provider)
+		t.Setenv("MAPBOX_ACCESS_TOKEN", tt.token)
+		_, isMapbox := defaultGeoFeatureProvider().(*MapboxProvider)
+		if isMapbox != tt.wantMapbox {
+			t.Errorf("GEO_PROVIDER=%q token=%q: mapbox = %v, want %v", tt.provider, tt.token, isMapbox, tt.wantMapbox)
+		}
+	}
+}
+
+func TestMapboxProviderNearOcean(t *testing.T) {
+	var lastPath, lastRadius string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath = r.URL.Path
+		lastRadius = r.URL.Query().Get("radius")
+		if r.URL.Query().Get("access_token") != "pk.secret" {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		features := []any{}
+		if strings.Contains(r.URL.Path, "-118.497") {
+			features = append(features, map[string]any{"type": "Feature"})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"features": features})
+	}))
+	defer server.Close()
+
+	provider := NewMapboxProvider("pk.secret")
+	provider.baseURL = server.URL
+
+	near, err := provider.NearOcean(34.0095, -118.4970, defaultGeoRadiusMeters)
+	if err != nil || !near {
+		t.Fatalf("Santa Monica: near = %v, err = %v", near, err)
+	}
+	if !strings.HasSuffix(lastPath, "/tilequery/-118.497000,34.009500.json") || lastRadius != "1609" {
+		t.Errorf("unexpected request %s radius %s", lastPath, lastRadius)
+	}
+
+	near, err = provider.NearOcean(39.7392, -104.9903, defaultGeoRadiusMeters)
+	if err != nil || near {
+		t.Fatalf("Denver: near = %v, err = %v", near, err)
+	}
+
+	provider.token = "pk.wrong"
+	if _, err := provider.NearOcean(0, 0, defaultGeoRadiusMeters); err == nil {
+		t.Error("want an error for a rejected token")
+	}
+
+	provider.baseURL = "http://127.0.0.1:1"
+	_, err = provider.NearOcean(0, 0, defaultGeoRadiusMeters)
+	if err == nil || strings.Contains(err.Error(), "pk.wrong") {
+		t.Errorf("connection errors must not leak the token: %v", err)
+	}
+}
+
+func TestGeoCacheRoundsCoordinates(t *testing.T) {
+	counting := &countingProvider{}
+	cache := newGeoCache(counting)
+
+	cache.NearOcean(34.0101, -118.4971, 1609)
+	cache.NearOcean(34.0099, -118.4969, 1609)
+	cache.NearOcean(34.0101, -118.4971, 5000)
+	if counting.calls != 2 {
+		t.Errorf("provider called %d times, want 2", counting.calls)
+	}
+}
+
+type countingProvider struct{ calls int }
+
+func (p *countingProvider) NearOcean(lat, lon, radiusMeters float64) (bool, error) {
+	p.calls++
+	return true, nil
+}
@@ -0,0 +1,430 @@
+package achievements
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// placeLevels are the sesh fields distinct_places can count, from coarse to
+// fine.
+var placeLevels = []string{"country", "region", "city"}
+
+// maxKilometers is half the earth's circumference, the largest possible
+// great-circle distance.
+const maxKilometers = 20_040
+
+// locatedRecord is a record in a condition's window with a usable location.
+type locatedRecord struct {
+	record   *core.Record
+	location latLon
+}
+
+// locatedRecords returns the profile's records in table with a location,
+// limited to the window.
+func locatedRecords(sc *scanContext, table, locationField string, w *DateWindow) ([]locatedRecord, error) {
+	window, err := sc.dateRange(w)
+	if err != nil {
+		return nil, err
+	}
+	records, err := sc.records(defaultString(table, "poop_seshes"))
+	if err != nil {
+		return nil, err
+	}
+
+	located := make([]locatedRecord, 0, len(records))
+	for _, record := range records {
+		if !window.contains(record.GetDateTime(window.Field).Time()) {
+			continue
+		}
+		if ll, ok := extractLatLon(record, defaultString(locationField, "location")); ok {
+			located = append(located, locatedRecord{record: record, location: ll})
+		}
+	}
+	return located, nil
+}
+
+// ---------------------------------------------------------------------------
+// Distinct places
+// ---------------------------------------------------------------------------
+
+func checkDistinctPlacesCondition(sc *scanContext, cond DistinctPlacesCondition) (*Progress, error) {
+	level := defaultString(cond.Level, "country")
+	depth := slices.Index(placeLevels, level)
+	if depth < 0 {
+		return nil, fmt.Errorf("unknown place level %q", level)
+	}
+	minCount := cond.MinCount
+	if minCount == 0 {
+		minCount = 1
+	}
+
+	window, err := sc.dateRange(cond.Window)
+	if err != nil {
+		return nil, err
+	}
+	records, err := sc.records(defaultString(cond.Table, "poop_seshes"))
+	if err != nil {
+		return nil, err
+	}
+
+	places := make(map[string]struct{})
+	for _, record := range records {
+		if !window.contains(record.GetDateTime(window.Field).Time()) {
+			continue
+		}
+		if key := placeKey(record, depth); key != "" {
+			places[key] = struct{}{}
+		}
+	}
+
+	return newProgress(float64(len(places)), float64(minCount), "greater_than_or_equal"), nil
+}
+
+// placeKey identifies the record's place down to placeLevels[depth], e.g.
+// "us/georgia" for a region. Names are compared case-insensitively. Records
+// without a value at that level have no key.
+func placeKey(record *core.Record, depth int) string {
+	parts := make([]string, depth+1)
+	for i, level := range placeLevels[:depth+1] {
+		parts[i] = strings.ToLower(strings.TrimSpace(record.GetString(level)))
+	}
+	if parts[depth] == "" {
+		return ""
+	}
+	return strings.Join(parts, "/")
+}
+
+// ---------------------------------------------------------------------------
+// Travel distance
+// ---------------------------------------------------------------------------
+
+// travelPrecision is the number of decimals locations are rounded to before
+// comparing pairs; seshes at home collapse into a handful of points.
+const travelPrecision = 2
+
+// travelCellSizes are the grid cells, in degrees, locations are clustered
+// on for the longest distance search, from coarse to fine.
+var travelCellSizes = []float64{10, 1, 0.1}
+
+// checkTravelDistanceCondition reports the largest distance between two
+// sesh locations in kilometers. The search stops as soon as the target is
+// reached.
+func checkTravelDistanceCondition(sc *scanContext, cond TravelDistanceCondition) (*Progress, error) {
+	located, err := locatedRecords(sc, cond.Table, cond.LocationField, cond.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := math.Pow(10, travelPrecision)
+	seen := make(map[latLon]struct{}, len(located))
+	points := make([]latLon, 0, len(located))
+	for _, l := range located {
+		p := latLon{Lat: math.Round(l.location.Lat*scale) / scale, Lon: math.Round(l.location.Lon*scale) / scale}
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			points = append(points, p)
+		}
+	}
+
+	longest := longestDistance(points, cond.MinKilometers*1000) / 1000
+	return newProgress(math.Round(longest*10)/10, cond.MinKilometers, "greater_than_or_equal"), nil
+}
+
+// travelCluster is a group of points sharing a grid cell. center is one of
+// the points and every point is within radius meters of it.
+type travelCluster struct {
+	center   latLon
+	radius   float64
+	children []*travelCluster
+}
+
+// newTravelCluster clusters points on the grid cells from
+// travelCellSizes[level] down; the leaves are the points themselves.
+func newTravelCluster(points []latLon, level int) *travelCluster {
+	if len(points) == 1 {
+		return &travelCluster{center: points[0]}
+	}
+
+	var children []*travelCluster
+	if level == len(travelCellSizes) {
+		children = make([]*travelCluster, len(points))
+		for i, p := range points {
+			children[i] = &travelCluster{center: p}
+		}
+	} else {
+		size := travelCellSizes[level]
+		cells := make(map[homeCell][]latLon)
+		var keys []homeCell
+		for _, p := range points {
+			cell := homeCell{int(math.Floor(p.Lat / size)), int(math.Floor(p.Lon / size))}
+			if _, ok := cells[cell]; !ok {
+				keys = append(keys, cell)
+			}
+			cells[cell] = append(cells[cell], p)
+		}
+		if len(keys) == 1 {
+			return newTravelCluster(points, level+1)
+		}
+		children = make([]*travelCluster, len(keys))
+		for i, cell := range keys {
+			children[i] = newTravelCluster(cells[cell], level+1)
+		}
+	}
+
+	c := &travelCluster{center: children[0].center, children: children}
+	for _, child := range children {
+		c.radius = math.Max(c.radius, greatCircleDistance(c.center, child.center)+child.radius)
+	}
+	return c
+}
+
+// clusterPair is two clusters, or a cluster with itself, and the bounds of
+// the longest distance between their points.
+type clusterPair struct {
+	a, b         *travelCluster
+	lower, upper float64
+}
+
+// clusterPairs is a max-heap of pairs by upper bound.
+type clusterPairs []clusterPair
+
+func (h clusterPairs) Len() int           { return len(h) }
+func (h clusterPairs) Less(i, j int) bool { return h[i].upper > h[j].upper }
+func (h clusterPairs) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *clusterPairs) Push(x any)        { *h = append(*h, x.(clusterPair)) }
+func (h *clusterPairs) Pop() any {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+func newClusterPair(a, b *travelCluster) clusterPair {
+	if a == b {
+		return clusterPair{a: a, b: b, upper: 2 * a.radius}
+	}
+	d := greatCircleDistance(a.center, b.center)
+	return clusterPair{a: a, b: b, lower: d, upper: math.Min(d+a.radius+b.radius, maxKilometers*1000)}
+}
+
+// longestDistance returns the largest great-circle distance in meters
+// between two of the points, or the first one found of at least stopAt
+// when stopAt is positive. Cluster pairs are opened largest upper bound
+// first and only while they could hold a longer distance, so points close
+// together are rarely compared with each other.
+func longestDistance(points []latLon, stopAt float64) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+
+	root := newTravelCluster(points, 0)
+	longest := 0.0
+	pending := &clusterPairs{newClusterPair(root, root)}
+	for pending.Len() > 0 {
+		pair := heap.Pop(pending).(clusterPair)
+		if pair.upper <= longest {
+			break
+		}
+
+		var next []clusterPair
+		switch {
+		case pair.a == pair.b:
+			for i, a := range pair.a.children {
+				for _, b := range pair.a.children[i:] {
+					next = append(next, newClusterPair(a, b))
+				}
+			}
+		case pair.b.radius > pair.a.radius:
+			for _, b := range pair.b.children {
+				next = append(next, newClusterPair(pair.a, b))
+			}
+		default:
+			for _, a := range pair.a.children {
+				next = append(next, newClusterPair(a, pair.b))
+			}
+		}
+
+		for _, p := range next {
+			longest = math.Max(longest, p.lower)
+			if stopAt > 0 && longest >= stopAt {
+				return longest
+			}
+		}
+		for _, p := range next {
+			if p.upper > longest {
+				heap.Push(pending, p)
+			}
+		}
+	}
+	return longest
+}
+
+// ---------------------------------------------------------------------------
+// GeoJSON polygons
+// ---------------------------------------------------------------------------
+
+func checkGeoPolygonCondition(sc *scanContext, cond GeoPolygonCondition) (*Progress, error) {
+	minCount := cond.MinCount
+	if minCount == 0 {
+		minCount = 1
+	}
+
+	area, err := parseGeoJSONPolygons(cond.Area)
+	if err != nil {
+		return nil, fmt.Errorf("parsing area: %w", err)
+	}
+	located, err := locatedRecords(sc, cond.Table, cond.LocationField, cond.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, l := range located {
+		if slices.ContainsFunc(area, func(poly polygon) bool { return poly.contains(l.location) }) {
+			count++
+		}
+	}
+
+	return newProgress(float64(count), float64(minCount), "greater_than_or_equal"), nil
+}
+
+// ---------------------------------------------------------------------------
+// Distance from home
+// ---------------------------------------------------------------------------
+
+// homeCellSize is the grid cell, in degrees, seshes are clustered on to find
+// home (about 1km).
+const homeCellSize = 0.01
+
+type homeCell struct{ lat, lon int }
+
+func checkHomeDistanceCondition(sc *scanContext, cond HomeDistanceCondition) (*Progress, error) {
+	minCount := cond.MinCount
+	if minCount == 0 {
+		minCount = 1
+	}
+
+	home, ok, err := sc.home(cond.Table, cond.LocationField)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return newProgress(0, float64(minCount), "greater_than_or_equal"), nil
+	}
+
+	located, err := locatedRecords(sc, cond.Table, cond.LocationField, cond.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, l := range located {
+		if greatCircleDistance(home, l.location)/1000 >= cond.MinKilometers {
+			count++
+		}
+	}
+
+	return newProgress(float64(count), float64(minCount), "greater_than_or_equal"), nil
+}
+
+// homeLocation is a memoised home lookup.
+type homeLocation struct {
+	Location latLon
+	OK       bool
+}
+
+// home finds the profile's home: seshes are binned into ~1km cells, the cell
+// whose 3x3 neighbourhood holds the most seshes wins and home is the mean
+// location of those seshes. ok is false when no sesh has a location.
+func (sc *scanContext) home(table, locationField string) (latLon, bool, error) {
+	table, locationField = defaultString(table, "poop_seshes"), defaultString(locationField, "location")
+
+	found, err := memoize(sc, "home:"+table+":"+locationField, func() (homeLocation, error) {
+		located, err := locatedRecords(sc, table, locationField, nil)
+		if err != nil || len(located) == 0 {
+			return homeLocation{}, err
+		}
+
+		cells := make(map[homeCell][]latLon)
+		for _, l := range located {
+			cell := homeCell{int(math.Floor(l.location.Lat / homeCellSize)), int(math.Floor(l.location.Lon / homeCellSize))}
+			cells[cell] = append(cells[cell], l.location)
+		}
+
+		neighbourhood := func(c homeCell) []latLon {
+			var points []latLon
+			for dLat := -1; dLat <= 1; dLat++ {
+				for dLon := -1; dLon <= 1; dLon++ {
+					points = append(points, cells[homeCell{c.lat + dLat, c.lon + dLon}]...)
+				}
+			}
+			return points
+		}
+
+		// Sorted so ties always pick the same cell.
+		keys := make([]homeCell, 0, len(cells))
+		for c := range cells {
+			keys = append(keys, c)
+		}
+		slices.SortFunc(keys, func(a, b homeCell) int {
+			return cmp.Or(cmp.Compare(a.lat, b.lat), cmp.Compare(a.lon, b.lon))
+		})
+
+		var best []latLon
+		for _, c := range keys {
+			if points := neighbourhood(c); len(points) > len(best) {
+				best = points
+			}
+		}
+
+		var home latLon
+		for _, p := range best {
+			home.Lat += p.Lat
+			home.Lon += p.Lon
+		}
+		home.Lat /= float64(len(best))
+		home.Lon /= float64(len(best))
+		return homeLocation{Location: home, OK: true}, nil
+	})
+	return found.Location, found.OK, err
+}
+
+// ---------------------------------------------------------------------------
+// Altitude
+// ---------------------------------------------------------------------------
+
+func checkAltitudeCondition(sc *scanContext, cond AltitudeCondition) (*Progress, error) {
+	minCount := cond.MinCount
+	if minCount == 0 {
+		minCount = 1
+	}
+	field := defaultString(cond.Field, "altitude")
+
+	// 0 is what the field stores when the device reported no altitude.
+	filter := field + " != 0"
+	if cond.MinMeters != nil {
+		filter += " && " + field + " >= " + strconv.FormatFloat(*cond.MinMeters, 'f', -1, 64)
+	}
+	if cond.MaxMeters != nil {
+		filter += " && " + field + " <= " + strconv.FormatFloat(*cond.MaxMeters, 'f', -1, 64)
+	}
+
+	count, err := sc.aggregate(AggregateCondition{
+		Table:       cond.Table,
+		Aggregation: "count",
+		Filter:      filter,
+		Window:      cond.Window,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newProgress(count.Value, float64(minCount), "greater_than_or_equal"), nil
+}
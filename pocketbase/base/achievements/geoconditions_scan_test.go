@@ -0,0 +1,222 @@
+package achievements
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// located returns a sesh at lat/lon in the given place, started at day
+// offset from 2026-06-01.
+func located(day int, lat, lon float64, country, region, city string) sesh {
+	return sesh{
+		started: time.Date(2026, 6, 1+day, 12, 0, 0, 0, time.UTC),
+		fields: map[string]any{
+			"location": map[string]float64{"lat": lat, "lon": lon},
+			"country":  country,
+			"region":   region,
+			"city":     city,
+		},
+	}
+}
+
+// newGeoTest returns a profile living in Berlin that travelled to Munich,
+// Barcelona and Tokyo, plus one sesh without a location.
+func newGeoTest(t *testing.T) (core.App, *core.Record) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "globetrotter", map[string]any{"timezone": "Europe/Berlin"})
+	var seshes []sesh
+	for i := range 6 {
+		seshes = append(seshes, located(i, 52.5200+float64(i)*0.001, 13.4050, "DE", "Berlin", "Berlin"))
+	}
+	seshes = append(seshes,
+		located(10, 48.1372, 11.5756, "de", "Bavaria", "Munich"),
+		located(11, 48.1375, 11.5760, "DE", "Bavaria", "munich "),
+		located(20, 41.3874, 2.1686, "ES", "Catalonia", "Barcelona"),
+		located(30, 35.6762, 139.6503, "JP", "Tokyo", "Tokyo"),
+		sesh{started: time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC), fields: map[string]any{"country": "FR", "region": "Normandy"}},
+	)
+	addSeshes(t, app, profile, seshes...)
+	return app, profile
+}
+
+// travels limits a condition to the seshes in Barcelona, Tokyo and
+// Normandy, the last one without a location.
+var travels = &DateWindow{From: "2026-06-21"}
+
+func TestDistinctPlacesCondition(t *testing.T) {
+	app, profile := newGeoTest(t)
+
+	tests := []struct {
+		cond DistinctPlacesCondition
+		want float64
+	}{
+		{DistinctPlacesCondition{}, 4},
+		{DistinctPlacesCondition{Level: "region"}, 5},
+		{DistinctPlacesCondition{Level: "city"}, 4},
+		{DistinctPlacesCondition{Level: "country", Window: travels}, 3},
+	}
+	for _, tt := range tests {
+		progress, err := checkDistinctPlacesCondition(newScanContext(app, profile.Id), tt.cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress.Current != tt.want {
+			t.Errorf("%s: %v places, want %v", tt.cond.Level, progress.Current, tt.want)
+		}
+	}
+
+	if _, err := checkDistinctPlacesCondition(newScanContext(app, profile.Id), DistinctPlacesCondition{Level: "street"}); err == nil {
+		t.Error("want an error for an unknown level")
+	}
+}
+
+func TestTravelDistanceCondition(t *testing.T) {
+	app, profile := newGeoTest(t)
+
+	tests := []struct {
+		name string
+		cond TravelDistanceCondition
+		met  bool
+		min  float64 // lowest acceptable progress
+		max  float64
+	}{
+		// Barcelona to Tokyo is about 10,400km.
+		{"longest", TravelDistanceCondition{MinKilometers: 20_000}, false, 10_350, 10_450},
+		{"target reached", TravelDistanceCondition{MinKilometers: 500}, true, 500, 10_450},
+		// Barcelona and Tokyo only.
+		{"window", TravelDistanceCondition{MinKilometers: 20_000, Window: travels}, false, 10_350, 10_450},
+		// Berlin only: the seshes are 500m apart, a kilometer once rounded.
+		{"at home", TravelDistanceCondition{MinKilometers: 2, Window: &DateWindow{Until: "2026-06-10"}}, false, 1, 1.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, err := checkTravelDistanceCondition(newScanContext(app, profile.Id), tt.cond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress.Met != tt.met || progress.Current < tt.min || progress.Current > tt.max {
+				t.Errorf("%vkm (met %v), want %v-%vkm (met %v)", progress.Current, progress.Met, tt.min, tt.max, tt.met)
+			}
+		})
+	}
+}
+
+func TestGeoPolygonCondition(t *testing.T) {
+	app, profile := newGeoTest(t)
+
+	// Roughly the Berlin city limits, and a feature collection adding a box
+	// around central Munich.
+	berlin := `{"type": "Polygon", "coordinates": [[[13.09, 52.34], [13.76, 52.34], [13.76, 52.68], [13.09, 52.68], [13.09, 52.34]]]}`
+	both := `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "geometry": ` + berlin + `},
+		{"type": "Feature", "geometry": {"type": "MultiPolygon", "coordinates": [[[[11.5, 48.1], [11.7, 48.1], [11.7, 48.2], [11.5, 48.2], [11.5, 48.1]]]]}}
+	]}`
+
+	tests := []struct {
+		name string
+		area string
+		want float64
+	}{
+		{"berlin", berlin, 6},
+		{"berlin and munich", both, 8},
+		{"ocean", `{"type": "Polygon", "coordinates": [[[-40, 0], [-30, 0], [-30, 10], [-40, 0]]]}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond := GeoPolygonCondition{Area: json.RawMessage(tt.area)}
+			progress, err := checkGeoPolygonCondition(newScanContext(app, profile.Id), cond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress.Current != tt.want {
+				t.Errorf("%v seshes inside, want %v", progress.Current, tt.want)
+			}
+		})
+	}
+
+	cond := GeoPolygonCondition{Area: json.RawMessage(`{"type": "Polygon", "coordinates": "nope"}`)}
+	if _, err := checkGeoPolygonCondition(newScanContext(app, profile.Id), cond); err == nil {
+		t.Error("want an error for invalid coordinates")
+	}
+}
+
+func TestHomeDistanceCondition(t *testing.T) {
+	app, profile := newGeoTest(t)
+
+	home, ok, err := newScanContext(app, profile.Id).home("", "")
+	if err != nil || !ok {
+		t.Fatalf("no home found: %v", err)
+	}
+	if d := greatCircleDistance(home, latLon{Lat: 52.5225, Lon: 13.405}); d > 500 {
+		t.Errorf("home is %.0fm from the Berlin seshes", d)
+	}
+
+	tests := []struct {
+		name string
+		cond HomeDistanceCondition
+		want float64
+	}{
+		{"away from home", HomeDistanceCondition{MinKilometers: 100}, 4},
+		{"far away", HomeDistanceCondition{MinKilometers: 1000}, 2},
+		{"other side of the world", HomeDistanceCondition{MinKilometers: 5000}, 1},
+		// The window limits the seshes counted, not the ones home is found from.
+		{"window", HomeDistanceCondition{MinKilometers: 100, Window: travels}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, err := checkHomeDistanceCondition(newScanContext(app, profile.Id), tt.cond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress.Current != tt.want {
+				t.Errorf("%v seshes away, want %v", progress.Current, tt.want)
+			}
+		})
+	}
+
+	nomad := apptest.NewProfile(t, app, "nomad", nil)
+	progress, err := checkHomeDistanceCondition(newScanContext(app, nomad.Id), HomeDistanceCondition{MinKilometers: 1})
+	if err != nil || progress.Current != 0 || progress.Met {
+		t.Errorf("profile without locations: %+v, %v", progress, err)
+	}
+}
+
+func TestAltitudeCondition(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "climber", nil)
+	day := time.Date(2026, 7, 1, 8, 0, 0, 0, time.UTC)
+	var seshes []sesh
+	for i, altitude := range []float64{0, 34, 1200, 3100, 4810, -430} {
+		seshes = append(seshes, sesh{started: day.AddDate(0, 0, i), fields: map[string]any{"altitude": altitude}})
+	}
+	addSeshes(t, app, profile, seshes...)
+
+	meters := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name string
+		cond AltitudeCondition
+		want float64
+	}{
+		{"above 3000m", AltitudeCondition{MinMeters: meters(3000)}, 2},
+		{"below sea level", AltitudeCondition{MaxMeters: meters(-1)}, 1},
+		// Seshes without an altitude store 0 and are left out.
+		{"between", AltitudeCondition{MinMeters: meters(-10), MaxMeters: meters(2000)}, 2},
+		{"window", AltitudeCondition{MinMeters: meters(1000), Window: &DateWindow{From: "2026-07-04", Until: "2026-07-06"}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, err := checkAltitudeCondition(newScanContext(app, profile.Id), tt.cond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress.Current != tt.want {
+				t.Errorf("%v seshes, want %v", progress.Current, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package achievements
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// pairwiseLongest is the exhaustive search longestDistance replaces.
+func pairwiseLongest(points []latLon) float64 {
+	longest := 0.0
+	for i := range points {
+		for j := i + 1; j < len(points); j++ {
+			longest = math.Max(longest, greatCircleDistance(points[i], points[j]))
+		}
+	}
+	return longest
+}
+
+// scatter returns n distinct points within spread degrees of center,
+// rounded the way checkTravelDistanceCondition rounds them.
+func scatter(rng *rand.Rand, center latLon, spread float64, n int) []latLon {
+	seen := make(map[latLon]bool)
+	var points []latLon
+	for len(points) < n {
+		p := latLon{
+			Lat: math.Max(-90, math.Min(90, center.Lat+(rng.Float64()*2-1)*spread)),
+			Lon: wrapLongitude(center.Lon + (rng.Float64()*2-1)*spread),
+		}
+		p.Lat, p.Lon = math.Round(p.Lat*100)/100, math.Round(p.Lon*100)/100
+		if !seen[p] {
+			seen[p] = true
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+func TestLongestDistanceMatchesPairwise(t *testing.T) {
+	rng := rand.New(rand.NewPCG(20, 20))
+	berlin := latLon{Lat: 52.52, Lon: 13.40}
+
+	tests := []struct {
+		name   string
+		points []latLon
+	}{
+		{"none", nil},
+		{"one", []latLon{berlin}},
+		{"two", []latLon{berlin, {Lat: 40.71, Lon: -74.01}}},
+		{"antipodes", []latLon{{Lat: 10, Lon: 20}, {Lat: -10, Lon: -160}}},
+		{"one city", scatter(rng, berlin, 0.2, 500)},
+		{"one region", scatter(rng, berlin, 3, 500)},
+		{"whole earth", scatter(rng, latLon{}, 180, 500)},
+		{"across the antimeridian", scatter(rng, latLon{Lat: -17, Lon: 179.9}, 2, 300)},
+		{"around the north pole", scatter(rng, latLon{Lat: 89, Lon: 0}, 2, 300)},
+		{"home and trips", append(append(scatter(rng, berlin, 0.1, 400),
+			scatter(rng, latLon{Lat: 41.39, Lon: 2.17}, 0.1, 50)...),
+			scatter(rng, latLon{Lat: 35.68, Lon: 139.69}, 0.1, 50)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := pairwiseLongest(tt.points)
+			if got := longestDistance(tt.points, 0); math.Abs(got-want) > 1e-6 {
+				t.Errorf("longest %.3fm, pairwise %.3fm", got, want)
+			}
+		})
+	}
+}
+
+func TestLongestDistanceStopsAtTarget(t *testing.T) {
+	rng := rand.New(rand.NewPCG(20, 21))
+	points := scatter(rng, latLon{}, 180, 500)
+	longest := pairwiseLongest(points)
+
+	for _, stopAt := range []float64{1_000, 1_000_000, longest / 2} {
+		got := longestDistance(points, stopAt)
+		if got < stopAt || got > longest {
+			t.Errorf("stopping at %.0fm returned %.0fm, want between it and %.0fm", stopAt, got, longest)
+		}
+	}
+	// A target further than any pair still finds the longest.
+	if got := longestDistance(points, longest+1); math.Abs(got-longest) > 1e-6 {
+		t.Errorf("unreachable target returned %.3fm, want %.3fm", got, longest)
+	}
+}
+
+func BenchmarkLongestDistance(b *testing.B) {
+	rng := rand.New(rand.NewPCG(20, 22))
+	home := scatter(rng, latLon{Lat: 52.52, Lon: 13.40}, 0.3, 3000)
+	trips := scatter(rng, latLon{}, 60, 500)
+	points := append(home, trips...)
+
+	b.Run("clustered", func(b *testing.B) {
+		for b.Loop() {
+			longestDistance(points, 0)
+		}
+	})
+	b.Run("pairwise", func(b *testing.B) {
+		for b.Loop() {
+			pairwiseLongest(points)
+		}
+	})
+}
+
+func TestPlaceKey(t *testing.T) {
+	tests := []struct {
+		country, region, city string
+		level                 string
+		want                  string
+	}{
+		{"US", "Georgia", "Atlanta", "country", "us"},
+		{"US", "Georgia", "Atlanta", "region", "us/georgia"},
+		{" us ", "GEORGIA", "Atlanta", "region", "us/georgia"},
+		{"GE", "Georgia", "", "region", "ge/georgia"},
+		{"US", "Georgia", "Atlanta", "city", "us/georgia/atlanta"},
+		{"US", "", "Springfield", "city", "us//springfield"},
+		{"US", "Georgia", "", "city", ""},
+		{"", "", "", "country", ""},
+	}
+
+	for _, tt := range tests {
+		record := newMemoryRecord(map[string]any{"country": tt.country, "region": tt.region, "city": tt.city})
+		depth := 0
+		for i, level := range placeLevels {
+			if level == tt.level {
+				depth = i
+			}
+		}
+		if got := placeKey(record, depth); got != tt.want {
+			t.Errorf("%s of %s/%s/%s: got %q, want %q", tt.level, tt.country, tt.region, tt.city, got, tt.want)
+		}
+	}
+}
+
+// newMemoryRecord returns an unsaved record holding the given text fields.
+func newMemoryRecord(fields map[string]any) *core.Record {
+	collection := core.NewBaseCollection("places")
+	for name := range fields {
+		collection.Fields.Add(&core.TextField{Name: name})
+	}
+	record := core.NewRecord(collection)
+	record.Load(fields)
+	return record
+}
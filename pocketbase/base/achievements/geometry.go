@@ -0,0 +1,215 @@
+package achievements
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// earthRadiusMeters is the mean earth radius.
+const earthRadiusMeters = 6371008.8
+
+// metersPerDegree is the length of one degree of latitude.
+const metersPerDegree = earthRadiusMeters * math.Pi / 180
+
+// greatCircleDistance returns the haversine distance between a and b in
+// meters.
+func greatCircleDistance(a, b latLon) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// ring is a closed line of lon/lat points; the last point may repeat the
+// first.
+type ring []latLon
+
+// contains reports whether p is inside the ring (even-odd rule).
+func (r ring) contains(p latLon) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// distance returns the distance in meters from p to the nearest edge of the
+// ring. Edges are measured in a local equirectangular projection around p,
+// which is accurate to well under a percent at the distances geo conditions
+// care about (a few kilometers).
+func (r ring) distance(p latLon) float64 {
+	scale := math.Cos(p.Lat * math.Pi / 180)
+
+	best := math.Inf(1)
+	for i := 1; i < len(r); i++ {
+		// The end of an edge is placed relative to its start, so an edge on
+		// the far side of the globe is not wrapped across p.
+		ax := wrapLongitude(r[i-1].Lon-p.Lon) * scale * metersPerDegree
+		bx := ax + wrapLongitude(r[i].Lon-r[i-1].Lon)*scale*metersPerDegree
+		ay := (r[i-1].Lat - p.Lat) * metersPerDegree
+		by := (r[i].Lat - p.Lat) * metersPerDegree
+		best = math.Min(best, originToSegment(ax, ay, bx, by))
+	}
+	return best
+}
+
+// originToSegment returns the distance from (0, 0) to the segment a-b.
+func originToSegment(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// wrapLongitude normalizes a longitude difference to [-180, 180).
+func wrapLongitude(d float64) float64 {
+	return math.Mod(math.Mod(d+180, 360)+360, 360) - 180
+}
+
+// polygon is an outer ring with optional holes.
+type polygon struct {
+	rings                          []ring
+	minLat, maxLat, minLon, maxLon float64
+}
+
+func newPolygon(rings []ring) polygon {
+	poly := polygon{rings: rings, minLat: 90, maxLat: -90, minLon: 180, maxLon: -180}
+	for _, p := range rings[0] {
+		poly.minLat, poly.maxLat = math.Min(poly.minLat, p.Lat), math.Max(poly.maxLat, p.Lat)
+		poly.minLon, poly.maxLon = math.Min(poly.minLon, p.Lon), math.Max(poly.maxLon, p.Lon)
+	}
+	return poly
+}
+
+// contains reports whether p is inside the outer ring and outside every hole.
+func (poly polygon) contains(p latLon) bool {
+	if !poly.nearBounds(p, 0) || !poly.rings[0].contains(p) {
+		return false
+	}
+	for _, hole := range poly.rings[1:] {
+		if hole.contains(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// boundaryDistance returns the distance in meters from p to the polygon's
+// nearest edge, holes included.
+func (poly polygon) boundaryDistance(p latLon) float64 {
+	best := math.Inf(1)
+	for _, r := range poly.rings {
+		best = math.Min(best, r.distance(p))
+	}
+	return best
+}
+
+// nearBounds reports whether p is within meters of the polygon's bounding
+// box, to skip polygons that cannot matter.
+func (poly polygon) nearBounds(p latLon, meters float64) bool {
+	dLat := meters / metersPerDegree
+	dLon := 180.0
+	if scale := math.Cos(p.Lat * math.Pi / 180); scale > 0.01 {
+		dLon = math.Min(180, dLat/scale)
+	}
+	return p.Lat >= poly.minLat-dLat && p.Lat <= poly.maxLat+dLat &&
+		p.Lon >= poly.minLon-dLon && p.Lon <= poly.maxLon+dLon
+}
+
+// geoJSON covers the GeoJSON objects that can carry polygons.
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Features    []geoJSON       `json:"features"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Geometries  []geoJSON       `json:"geometries"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// parseGeoJSONPolygons returns every Polygon and MultiPolygon in a GeoJSON
+// geometry, feature or collection. Other geometry types are skipped.
+func parseGeoJSONPolygons(data []byte) ([]polygon, error) {
+	var root geoJSON
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	var polygons []polygon
+	var walk func(g geoJSON) error
+	walk = func(g geoJSON) error {
+		switch g.Type {
+		case "FeatureCollection":
+			for _, f := range g.Features {
+				if err := walk(f); err != nil {
+					return err
+				}
+			}
+		case "Feature":
+			if g.Geometry != nil {
+				return walk(*g.Geometry)
+			}
+		case "GeometryCollection":
+			for _, child := range g.Geometries {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case "Polygon":
+			var coords [][][]float64
+			if err := json.Unmarshal(g.Coordinates, &coords); err != nil {
+				return fmt.Errorf("invalid Polygon coordinates: %w", err)
+			}
+			poly, err := polygonFromCoordinates(coords)
+			if err != nil {
+				return err
+			}
+			polygons = append(polygons, poly)
+		case "MultiPolygon":
+			var coords [][][][]float64
+			if err := json.Unmarshal(g.Coordinates, &coords); err != nil {
+				return fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+			}
+			for _, c := range coords {
+				poly, err := polygonFromCoordinates(c)
+				if err != nil {
+					return err
+				}
+				polygons = append(polygons, poly)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return polygons, nil
+}
+
+func polygonFromCoordinates(coords [][][]float64) (polygon, error) {
+	if len(coords) == 0 {
+		return polygon{}, fmt.Errorf("polygon has no rings")
+	}
+	rings := make([]ring, len(coords))
+	for i, c := range coords {
+		if len(c) < 4 {
+			return polygon{}, fmt.Errorf("polygon ring needs at least 4 positions, got %d", len(c))
+		}
+		rings[i] = make(ring, len(c))
+		for j, position := range c {
+			if len(position) < 2 {
+				return polygon{}, fmt.Errorf("invalid position %v", position)
+			}
+			rings[i][j] = latLon{Lon: position[0], Lat: position[1]}
+		}
+	}
+	return newPolygon(rings), nil
+}
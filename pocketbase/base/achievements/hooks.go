@@ -0,0 +1,41 @@
+package achievements
+
+import (
+	"log"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterHooks binds the achievement and streak record hooks.
+func RegisterHooks(app *pocketbase.PocketBase) {
+	// Reject achievements whose criteria or tiers would fail at scan time, or
+	// whose availability window is empty.
+	app.OnRecordCreateRequest("achievements").BindFunc(validateAchievementRequest)
+	app.OnRecordUpdateRequest("achievements").BindFunc(validateAchievementRequest)
+
+	// Keep the stored streaks in step with the profile's seshes.
+	streakService := NewStreakService(app)
+	app.OnRecordAfterCreateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		if err := streakService.RecordSesh(e.Record); err != nil {
+			log.Printf("Error updating streaks for profile %s: %v", e.Record.GetString("poo_profile"), err)
+		}
+		return e.Next()
+	})
+	app.OnRecordAfterUpdateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+		if e.Record.GetString("started") != original.GetString("started") ||
+			e.Record.GetString("timezone") != original.GetString("timezone") {
+			if err := streakService.Recompute(e.Record.GetString("poo_profile")); err != nil {
+				log.Printf("Error recomputing streaks for profile %s: %v", e.Record.GetString("poo_profile"), err)
+			}
+		}
+		return e.Next()
+	})
+	app.OnRecordAfterDeleteSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		if err := streakService.Recompute(e.Record.GetString("poo_profile")); err != nil {
+			log.Printf("Error recomputing streaks for profile %s: %v", e.Record.GetString("poo_profile"), err)
+		}
+		return e.Next()
+	})
+}
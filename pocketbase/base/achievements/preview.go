@@ -0,0 +1,162 @@
+package achievements
+
+import (
+	"encoding/json"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultPreviewSample = 10
+	maxPreviewSample     = 100
+)
+
+// previewRequest is the body of POST /api/admin/achievements/preview. The
+// criteria are evaluated for ProfileId or, when it is empty, for Sample
+// random profiles. The eligibility settings and tiers of the draft
+// achievement are applied the way a scan applies them.
+type previewRequest struct {
+	Criteria          json.RawMessage `json:"criteria"`
+	Tiers             json.RawMessage `json:"tiers"`
+	MinSeshes         int             `json:"minSeshes"`
+	MinAccountAgeDays int             `json:"minAccountAgeDays"`
+	ProfileId         string          `json:"profileId"`
+	Sample            int             `json:"sample"`
+}
+
+// PreviewResult is the evaluation of draft criteria for one profile. Trace
+// holds the computed value, operator, target and outcome of every node;
+// for tiered drafts it is the progress towards the next tier. Profiles the
+// eligibility settings exclude are not evaluated.
+type PreviewResult struct {
+	ProfileId  string    `json:"profileId"`
+	CodeName   string    `json:"codeName"`
+	Eligible   bool      `json:"eligible"`
+	Ineligible string    `json:"ineligible,omitempty"` // why the profile is not eligible
+	Met        bool      `json:"met"`
+	Tier       int       `json:"tier"`     // tier reached, 0 for untiered drafts
+	TierName   string    `json:"tierName"` // "" for untiered drafts
+	Trace      *Progress `json:"trace"`
+	Queries    int       `json:"queries"` // database reads the evaluation needed
+}
+
+// PreviewResponse summarises a preview run.
+type PreviewResponse struct {
+	Evaluated  int             `json:"evaluated"`
+	Ineligible int             `json:"ineligible"`
+	Matched    int             `json:"matched"`
+	Results    []PreviewResult `json:"results"`
+}
+
+// previewCriteria validates the draft criteria and tiers and evaluates them
+// with the same eligibility check and evaluators as a real scan. Nothing is
+// stored.
+func previewCriteria(app core.App, body previewRequest) (*PreviewResponse, error) {
+	if len(body.Criteria) == 0 {
+		return nil, apis.NewBadRequestError("Missing criteria.", validation.Errors{
+			"criteria": validation.NewError("validation_required", "Cannot be blank."),
+		})
+	}
+	criteria, err := ParseCriteria(unwrapJSONString(body.Criteria))
+	if err == nil {
+		err = validateCriteriaNode(app, criteria)
+	}
+	if err != nil {
+		return nil, apis.NewBadRequestError("Invalid achievement criteria.", validation.Errors{
+			"criteria": validation.NewError("validation_invalid_criteria", err.Error()),
+		})
+	}
+
+	tiers, err := decodeTiers(unwrapJSONString(body.Tiers))
+	if err == nil {
+		err = validateTiers(app, criteria, tiers)
+	}
+	if err != nil {
+		return nil, apis.NewBadRequestError("Invalid achievement tiers.", validation.Errors{
+			"tiers": validation.NewError("validation_invalid_tiers", err.Error()),
+		})
+	}
+
+	eligibility := Eligibility{MinSeshes: body.MinSeshes, MinAccountAgeDays: body.MinAccountAgeDays}
+
+	profiles, err := previewProfiles(app, body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PreviewResponse{Results: make([]PreviewResult, 0, len(profiles))}
+	now := time.Now()
+	for _, profile := range profiles {
+		sc := newScanContext(app, profile.Id)
+		result := PreviewResult{ProfileId: profile.Id, CodeName: profile.GetString("codeName")}
+
+		facts, err := sc.profileFacts()
+		if err != nil {
+			return nil, apis.NewInternalServerError("Failed to evaluate criteria for profile "+profile.Id+".", err)
+		}
+		result.Eligible, result.Ineligible = eligibility.check(facts, now)
+		if !result.Eligible {
+			response.Ineligible++
+			result.Queries = sc.stats.Queries
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		trace, tier, err := evaluateTiered(sc, criteria, tiers, 0)
+		if err != nil {
+			return nil, apis.NewInternalServerError("Failed to evaluate criteria for profile "+profile.Id+".", err)
+		}
+
+		response.Evaluated++
+		result.Met = tier > 0
+		if result.Met {
+			response.Matched++
+		}
+		if len(tiers) > 0 {
+			result.Tier, result.TierName = tier, tierName(tiers, tier)
+		}
+		result.Trace = trace
+		result.Queries = sc.stats.Queries
+		response.Results = append(response.Results, result)
+	}
+
+	return response, nil
+}
+
+// unwrapJSONString returns the JSON encoded in raw when raw is a JSON
+// string, the way record JSON fields are submitted, and raw otherwise.
+func unwrapJSONString(raw json.RawMessage) []byte {
+	var encoded string
+	if json.Unmarshal(raw, &encoded) == nil {
+		return []byte(encoded)
+	}
+	return raw
+}
+
+// previewProfiles returns the requested profile or a random sample.
+func previewProfiles(app core.App, body previewRequest) ([]*core.Record, error) {
+	if body.ProfileId != "" {
+		profile, err := app.FindRecordById("poo_profiles", body.ProfileId)
+		if err != nil {
+			return nil, apis.NewNotFoundError("Poo profile not found.", err)
+		}
+		return []*core.Record{profile}, nil
+	}
+
+	sample := body.Sample
+	if sample <= 0 {
+		sample = defaultPreviewSample
+	}
+	if sample > maxPreviewSample {
+		sample = maxPreviewSample
+	}
+
+	profiles, err := app.FindRecordsByFilter("poo_profiles", "", "@random", sample, 0)
+	if err != nil {
+		return nil, apis.NewInternalServerError("Failed to load profiles.", err)
+	}
+	return profiles, nil
+}
@@ -0,0 +1,123 @@
+package achievements
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+func TestPreviewAppliesEligibilityAndTiers(t *testing.T) {
+	app := apptest.NewApp(t)
+	regular := apptest.NewProfile(t, app, "regular", nil)
+	newbie := apptest.NewProfile(t, app, "newbie", nil)
+	var seshes []sesh
+	for i := range 12 {
+		seshes = append(seshes, sesh{started: time.Date(2026, 5, 1+i, 8, 0, 0, 0, time.UTC)})
+	}
+	addSeshes(t, app, regular, seshes...)
+	addSeshes(t, app, newbie, seshes[:3]...)
+
+	criteria := `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 5}`
+	encoded, _ := json.Marshal(criteria)
+
+	tests := []struct {
+		name  string
+		body  previewRequest
+		tier  int
+		met   bool
+		trace float64 // target of the trace
+	}{
+		{"untiered", previewRequest{Criteria: json.RawMessage(criteria)}, 0, true, 5},
+		{"criteria as a string", previewRequest{Criteria: encoded}, 0, true, 5},
+		{
+			"tiered",
+			previewRequest{
+				Criteria: json.RawMessage(criteria),
+				Tiers:    json.RawMessage(`[{"name": "Bronze", "value": 5}, {"name": "Silver", "value": 10}, {"name": "Gold", "value": 20}]`),
+			},
+			2, true, 20,
+		},
+		{
+			"tiers as a string",
+			previewRequest{
+				Criteria: json.RawMessage(criteria),
+				Tiers:    json.RawMessage(`"[{\"name\": \"Gold\", \"value\": 20}]"`),
+			},
+			0, false, 20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.body.MinSeshes = 4
+			tt.body.ProfileId = regular.Id
+			response, err := previewCriteria(app, tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := response.Results[0]
+			if !result.Eligible || result.Met != tt.met || result.Tier != tt.tier || result.Trace.Target != tt.trace {
+				t.Errorf("eligible %v, met %v, tier %d (%s), target %v; want met %v, tier %d, target %v",
+					result.Eligible, result.Met, result.Tier, result.TierName, result.Trace.Target, tt.met, tt.tier, tt.trace)
+			}
+		})
+	}
+
+	// Sampling every profile: the newbie has too few seshes to be evaluated.
+	response, err := previewCriteria(app, previewRequest{Criteria: json.RawMessage(criteria), MinSeshes: 4, Sample: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Evaluated != 1 || response.Ineligible != 1 || response.Matched != 1 {
+		t.Errorf("evaluated %d, ineligible %d, matched %d; want 1 of each", response.Evaluated, response.Ineligible, response.Matched)
+	}
+	for _, result := range response.Results {
+		if result.ProfileId == newbie.Id && (result.Eligible || result.Ineligible == "" || result.Trace != nil) {
+			t.Errorf("newbie: %+v, want ineligible and not evaluated", result)
+		}
+	}
+}
+
+func TestPreviewRejectsInvalidDrafts(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "tester", nil)
+	criteria := json.RawMessage(`{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 5}`)
+
+	for name, body := range map[string]previewRequest{
+		"no criteria":         {ProfileId: profile.Id},
+		"bad criteria":        {ProfileId: profile.Id, Criteria: json.RawMessage(`{"all": []}`)},
+		"unknown field":       {ProfileId: profile.Id, Criteria: json.RawMessage(`{"conditionType": "aggregate", "aggregation": "sum", "field": "nope", "operator": "greater_than", "value": 1}`)},
+		"bad tiers":           {ProfileId: profile.Id, Criteria: criteria, Tiers: json.RawMessage(`[{"name": "Gold", "value": 5}, {"name": "Silver", "value": 1}]`)},
+		"tiers without value": {ProfileId: profile.Id, Criteria: json.RawMessage(`{"none": [` + string(criteria) + `]}`), Tiers: json.RawMessage(`[{"name": "Gold", "value": 5}]`)},
+		"unknown profile":     {ProfileId: "nope", Criteria: criteria},
+	} {
+		_, err := previewCriteria(app, body)
+		var apiErr *router.ApiError
+		if !errors.As(err, &apiErr) || apiErr.Status >= http.StatusInternalServerError {
+			t.Errorf("%s: error %v, want a client error", name, err)
+		}
+	}
+}
+
+func TestPreviewReportsQueryFailuresAsServerErrors(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "tester", nil)
+	criteria := json.RawMessage(`{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 5}`)
+
+	// The schema still knows the table, so the criteria validate, but every
+	// query against it fails.
+	if _, err := app.DB().NewQuery("DROP TABLE poop_seshes").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := previewCriteria(app, previewRequest{ProfileId: profile.Id, Criteria: criteria})
+	var apiErr *router.ApiError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusInternalServerError {
+		t.Errorf("error %v, want a 500", err)
+	}
+}
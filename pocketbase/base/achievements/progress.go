@@ -0,0 +1,242 @@
+package achievements
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Progress is the result of evaluating a criteria node for a profile: the
+// value reached so far, the target it is compared against and whether the
+// node matched. Group nodes carry the progress of their children.
+type Progress struct {
+	Group         string      `json:"group,omitempty"`
+	ConditionType string      `json:"conditionType,omitempty"`
+	Operator      string      `json:"operator,omitempty"`
+	Current       float64     `json:"current"`
+	Target        float64     `json:"target"`
+	Met           bool        `json:"met"`
+	Children      []*Progress `json:"children,omitempty"`
+}
+
+// newProgress builds a leaf result, matching current against target with the
+// given operator.
+func newProgress(current, target float64, operator string) *Progress {
+	return &Progress{
+		Operator: operator,
+		Current:  current,
+		Target:   target,
+		Met:      matchesConditionFloat(current, target, operator),
+	}
+}
+
+// Ratio returns how close the node is to matching, between 0 and 1.
+// Conditions that cannot be expressed as "reach a target" (less_than,
+// not_equals...) are either 0 or 1.
+func (p *Progress) Ratio() float64 {
+	if p.Met {
+		return 1
+	}
+	if p.Target <= 0 {
+		return 0
+	}
+	switch p.Operator {
+	case "greater_than", "greater_than_or_equal", "equals":
+	default:
+		return 0
+	}
+	// Not met yet, so never report a full bar (e.g. greater_than at the target).
+	return math.Max(0, math.Min(p.Current/p.Target, 0.99))
+}
+
+// Percent returns Ratio as a percentage rounded to one decimal.
+func (p *Progress) Percent() float64 {
+	return math.Round(p.Ratio()*1000) / 10
+}
+
+// groupProgress combines the results of a group's children.
+//
+// A single-child group passes its child's value through so legacy criteria
+// keep reporting e.g. "7/10 seshes". Otherwise "all" counts the summed child
+// ratios against the number of children, "any" reports its closest child and
+// "none" counts the children that did not match.
+func groupProgress(group string, children []*Progress) *Progress {
+	p := &Progress{Group: group, Children: children}
+	if len(children) == 0 {
+		return p
+	}
+
+	switch group {
+	case GroupAll:
+		if len(children) == 1 {
+			c := children[0]
+			p.Current, p.Target, p.Operator, p.Met = c.Current, c.Target, c.Operator, c.Met
+			return p
+		}
+		p.Met = true
+		for _, c := range children {
+			p.Met = p.Met && c.Met
+			p.Current += c.Ratio()
+		}
+		p.Target = float64(len(children))
+		p.Operator = "greater_than_or_equal"
+		return p
+	case GroupAny:
+		best := children[0]
+		for _, c := range children {
+			p.Met = p.Met || c.Met
+			if c.Ratio() > best.Ratio() {
+				best = c
+			}
+		}
+		p.Current, p.Target, p.Operator = best.Current, best.Target, best.Operator
+		return p
+	case GroupNone:
+		p.Met = true
+		for _, c := range children {
+			if c.Met {
+				p.Met = false
+			} else {
+				p.Current++
+			}
+		}
+		p.Target = float64(len(children))
+		p.Operator = "greater_than_or_equal"
+		return p
+	}
+
+	return p
+}
+
+// AchievementProgress is a profile's stored progress towards one achievement.
+type AchievementProgress struct {
+	AchievementId string    `json:"achievementId"`
+	Name          string    `json:"name"`
+	Current       float64   `json:"current"`
+	Target        float64   `json:"target"`
+	Percent       float64   `json:"percent"`
+	Met           bool      `json:"met"`
+	Unlocked      bool      `json:"unlocked"`
+	Tier          int       `json:"tier"`     // highest tier owned, 0 for untiered or locked
+	TierName      string    `json:"tierName"` // name of Tier
+	Tiers         []string  `json:"tiers,omitempty"`
+	UnlockPercent float64   `json:"unlockPercent"` // share of profiles that own it, see RefreshRarity
+	Details       *Progress `json:"details,omitempty"`
+}
+
+// SaveProgress stores the latest evaluation of an achievement for a profile,
+// updating the existing achievement_progress record when there is one.
+func (s *AchievementService) SaveProgress(poopProfileId string, achievementId string, progress *Progress) error {
+	return s.saveProgress(newScanContext(s.app, poopProfileId), achievementId, progress)
+}
+
+// saveProgress is SaveProgress reusing the progress records loaded by sc.
+func (s *AchievementService) saveProgress(sc *scanContext, achievementId string, progress *Progress) error {
+	stored, err := sc.progressRecords()
+	if err != nil {
+		return err
+	}
+
+	record, ok := stored[achievementId]
+	if !ok {
+		collection, err := s.app.FindCachedCollectionByNameOrId("achievement_progress")
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(collection)
+		record.Set("poo_profile", sc.profileId)
+		record.Set("achievement", achievementId)
+	}
+
+	record.Set("current", progress.Current)
+	record.Set("target", progress.Target)
+	record.Set("percent", progress.Percent())
+	record.Set("met", progress.Met)
+	record.Set("details", progress)
+
+	if err := s.app.Save(record); err != nil {
+		return err
+	}
+	stored[achievementId] = record
+	return nil
+}
+
+// ProfileProgress returns the profile's progress for every active
+// achievement. It only reads: progress is stored by scans, which keep
+// evaluating owned tiered achievements towards their next tier. Achievements
+// without stored progress, and owned ones whose stored progress predates the
+// grant (e.g. granted by hand), are evaluated on the fly without storing the
+// result.
+func (s *AchievementService) ProfileProgress(poopProfileId string) ([]AchievementProgress, error) {
+	achievements, err := s.activeAchievements()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := newScanContext(s.app, poopProfileId)
+	stored, err := sc.progressRecords()
+	if err != nil {
+		return nil, err
+	}
+	owned, err := sc.owned()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]AchievementProgress, 0, len(achievements))
+	for _, achievement := range achievements {
+		tiers, err := parseTiers(achievement)
+		if err != nil {
+			log.Printf("Error reading tiers of achievement %s: %v", achievement.Id, err)
+			continue
+		}
+
+		grant, unlocked := owned[achievement.Id]
+		item := AchievementProgress{
+			AchievementId: achievement.Id,
+			Name:          achievement.GetString("name"),
+			Unlocked:      unlocked,
+			UnlockPercent: achievement.GetFloat("unlock_percent"),
+		}
+		ownedTier := 0
+		if unlocked {
+			ownedTier = ownedTierOf(grant)
+		}
+		if len(tiers) > 0 {
+			item.Tier = ownedTier
+			item.TierName = tierName(tiers, ownedTier)
+			for _, tier := range tiers {
+				item.Tiers = append(item.Tiers, tier.Name)
+			}
+		}
+
+		complete := unlocked && ownedTier >= max(len(tiers), 1)
+		if record, ok := stored[achievement.Id]; ok && (!complete || record.GetBool("met")) {
+			item.Current = record.GetFloat("current")
+			item.Target = record.GetFloat("target")
+			item.Percent = record.GetFloat("percent")
+			item.Met = record.GetBool("met")
+			var details Progress
+			if err := json.Unmarshal([]byte(record.GetString("details")), &details); err == nil {
+				item.Details = &details
+			}
+		} else {
+			progress, _, err := evaluateAchievement(sc, achievement, tiers, ownedTier)
+			if err != nil {
+				log.Printf("Error evaluating progress for achievement %s: %v", achievement.Id, err)
+				continue
+			}
+			item.Current = progress.Current
+			item.Target = progress.Target
+			item.Percent = progress.Percent()
+			item.Met = progress.Met
+			item.Details = progress
+		}
+
+		result = append(result, item)
+	}
+
+	return result, nil
+}
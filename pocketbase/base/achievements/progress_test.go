@@ -0,0 +1,64 @@
+package achievements
+
+import (
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+)
+
+func TestProfileProgressOnlyReads(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "reader", nil)
+	addSeshes(t, app, profile, daily(time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC), 3)...)
+	newAchievement(t, app, "Five", `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 5}`, nil)
+
+	progress, err := NewAchievementService(app).ProfileProgress(profile.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 1 || progress[0].Current != 3 || progress[0].Target != 5 || progress[0].Percent != 60 {
+		t.Fatalf("progress %+v, want 3/5 (60%%)", progress)
+	}
+	if stored, _ := app.CountRecords("achievement_progress"); stored != 0 {
+		t.Errorf("%d progress records stored by a read", stored)
+	}
+}
+
+func TestScansKeepTieredProgressCurrent(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "climber", nil)
+	seshes := daily(time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC), 4)
+	addSeshes(t, app, profile, seshes[:3]...)
+	achievement := newAchievement(t, app, "Counter",
+		`{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 2}`,
+		map[string]any{"tiers": `[{"name": "Bronze", "value": 2}, {"name": "Silver", "value": 5}]`})
+
+	service := NewAchievementService(app)
+	check := func(current float64) {
+		t.Helper()
+		if _, err := service.Scan(profile.Id); err != nil {
+			t.Fatal(err)
+		}
+		record, err := app.FindFirstRecordByFilter("achievement_progress", "poo_profile = {:p} && achievement = {:a}",
+			map[string]any{"p": profile.Id, "a": achievement.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.GetFloat("current") != current || record.GetFloat("target") != 5 {
+			t.Errorf("stored %v/%v, want %v/5 towards Silver", record.GetFloat("current"), record.GetFloat("target"), current)
+		}
+
+		progress, err := service.ProfileProgress(profile.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress[0].TierName != "Bronze" || progress[0].Current != current {
+			t.Errorf("reported %s at %v, want Bronze at %v", progress[0].TierName, progress[0].Current, current)
+		}
+	}
+
+	check(3)
+	addSeshes(t, app, profile, seshes[3])
+	check(4)
+}
@@ -0,0 +1,39 @@
+package achievements
+
+import (
+	"loglog/events"
+)
+
+// Publisher returns a ScanHandler that publishes the scan's grants and
+// revocations to the event bus, where the activity feed and webhooks
+// pick them up.
+func Publisher(bus *events.Bus) ScanHandler {
+	return func(poopProfileId string, result *ScanResult) {
+		for _, grant := range result.Grants {
+			eventType := events.AchievementEarned
+			if grant.Upgrade {
+				eventType = events.AchievementUpgraded
+			}
+			data := map[string]any{"achievementId": grant.AchievementId}
+			if grant.TierName != "" {
+				data["tier"] = grant.Tier
+				data["tierName"] = grant.TierName
+			}
+			bus.Publish(events.Event{Type: eventType, ProfileId: poopProfileId, Data: data})
+		}
+
+		for _, revocation := range result.Revoked {
+			bus.Publish(events.Event{
+				Type:      events.AchievementRevoked,
+				ProfileId: poopProfileId,
+				Data: map[string]any{
+					"achievementId": revocation.AchievementId,
+					"removed":       revocation.Removed,
+					"fromTier":      revocation.FromTier,
+					"toTier":        revocation.ToTier,
+					"reason":        revocation.Reason,
+				},
+			})
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package achievements
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+// profileQuery starts a select over the profile's records in table. The
+// optional filter is a PocketBase filter expression; it is resolved against
+// the collection schema and applied as an id subquery so relation joins it
+// needs cannot duplicate rows in the aggregates computed on top.
+func profileQuery(app core.App, table, profileField, profileId, filter string) (*dbx.SelectQuery, *core.Collection, error) {
+	collection, err := app.FindCachedCollectionByNameOrId(table)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown table %q: %w", table, err)
+	}
+	if profileField == "" {
+		profileField = "poo_profile"
+	}
+	if err := requireField(collection, profileField); err != nil {
+		return nil, nil, err
+	}
+
+	query := app.ConcurrentDB().
+		Select().
+		From(collection.Name).
+		Where(dbx.NewExp("[["+profileField+"]] = {:profileId}", dbx.Params{"profileId": profileId}))
+
+	if filter != "" {
+		resolver := core.NewRecordFieldResolver(app, collection, nil, true)
+		expr, err := search.FilterData(filter).BuildExpr(resolver)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid filter %q: %w", filter, err)
+		}
+
+		inner := app.ConcurrentDB().
+			Select("{{" + collection.Name + "}}.[[id]]").
+			From(collection.Name).
+			AndWhere(expr)
+		if err := resolver.UpdateQuery(inner); err != nil {
+			return nil, nil, err
+		}
+
+		built := inner.Build()
+		query.AndWhere(dbx.NewExp("[[id]] IN ("+built.SQL()+")", built.Params()))
+	}
+
+	return query, collection, nil
+}
+
+// requireField checks that the collection has a field with the given name,
+// which also makes the name safe to use as a quoted column.
+func requireField(collection *core.Collection, name string) error {
+	if collection.Fields.GetByName(name) == nil {
+		return fmt.Errorf("unknown field %q in %s", name, collection.Name)
+	}
+	return nil
+}
+
+// queryAggregate computes the aggregate value for cond with a single SQL
+// query. ok is false when the aggregate is undefined (avg over no records).
+func queryAggregate(app core.App, cond AggregateCondition, profileId string, window dateRange) (value float64, ok bool, err error) {
+	table := cond.Table
+	if table == "" {
+		table = "poop_seshes"
+	}
+
+	query, collection, err := profileQuery(app, table, cond.ProfileField, profileId, cond.Filter)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := window.apply(query, collection); err != nil {
+		return 0, false, err
+	}
+	if cond.Aggregation != "count" {
+		if err := requireField(collection, cond.Field); err != nil {
+			return 0, false, err
+		}
+	}
+	field := "[[" + cond.Field + "]]"
+
+	switch cond.Aggregation {
+	case "count":
+		var n int64
+		err = query.Select("COUNT(*)").Row(&n)
+		return float64(n), true, err
+
+	case "count_distinct":
+		var n int64
+		err = query.Select("COUNT(DISTINCT " + field + ")").
+			AndWhere(dbx.NewExp(field + " != ''")).
+			Row(&n)
+		return float64(n), true, err
+
+	case "sum":
+		var sum float64
+		err = query.Select("COALESCE(SUM(" + field + "), 0)").Row(&sum)
+		return sum, true, err
+
+	// avg divides by every record (non-numeric values count as 0) rather
+	// than using AVG(), which would skip NULLs.
+	case "avg":
+		var n int64
+		var sum float64
+		if err = query.Select("COUNT(*)", "COALESCE(SUM("+field+"), 0)").Row(&n, &sum); err != nil {
+			return 0, false, err
+		}
+		if n == 0 {
+			return 0, false, nil
+		}
+		return sum / float64(n), true, nil
+
+	// max_group_count: the highest per-value count across all records.
+	case "max_group_count":
+		var n int64
+		err = query.Select("COUNT(*) AS n").
+			AndWhere(dbx.NewExp(field + " != ''")).
+			GroupBy(cond.Field).
+			OrderBy("n DESC").
+			Limit(1).
+			Row(&n)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, true, nil
+		}
+		return float64(n), true, err
+
+	default:
+		return 0, false, fmt.Errorf("unknown aggregation type: %s", cond.Aggregation)
+	}
+}
+
+// durationStats summarises the durations (in seconds) between two datetime
+// fields over the profile's completed records.
+type durationStats struct {
+	Matches  int     // records whose duration satisfies the operator
+	Longest  float64 // longest duration
+	Shortest float64 // shortest duration
+}
+
+// queryDurationStats computes durationStats for cond with a single query.
+func queryDurationStats(app core.App, cond CalculatedCondition, profileId string, thresholdSeconds float64, window dateRange) (durationStats, error) {
+	var stats durationStats
+
+	table := cond.Table
+	if table == "" {
+		table = "poop_seshes"
+	}
+	query, collection, err := profileQuery(app, table, "", profileId, "")
+	if err != nil {
+		return stats, err
+	}
+	for _, f := range []string{cond.StartField, cond.EndField} {
+		if err := requireField(collection, f); err != nil {
+			return stats, err
+		}
+	}
+	if err := window.apply(query, collection); err != nil {
+		return stats, err
+	}
+	sqlOp, err := operatorToSQL(cond.Operator)
+	if err != nil {
+		return stats, err
+	}
+
+	start, end := "[["+cond.StartField+"]]", "[["+cond.EndField+"]]"
+	duration := "(unixepoch(" + end + ", 'subsec') - unixepoch(" + start + ", 'subsec'))"
+
+	var longest, shortest sql.NullFloat64
+	var matches int64
+	err = query.
+		Select(
+			"COALESCE(SUM(CASE WHEN "+duration+" "+sqlOp+" {:threshold} THEN 1 ELSE 0 END), 0)",
+			"MAX("+duration+")",
+			"MIN("+duration+")",
+		).
+		AndWhere(dbx.NewExp(start+" != '' AND "+end+" != ''")).
+		AndBind(dbx.Params{"threshold": thresholdSeconds}).
+		Row(&matches, &longest, &shortest)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Matches = int(matches)
+	stats.Longest = longest.Float64
+	stats.Shortest = shortest.Float64
+	return stats, nil
+}
+
+// queryLocalTimes returns the profile's non-empty field values inside window,
+// each converted to the zone recorded on its record (when the table has a
+// timezone field), falling back to the given zone.
+func queryLocalTimes(app core.App, table, field, profileId string, fallback *time.Location, window dateRange) ([]time.Time, error) {
+	query, collection, err := profileQuery(app, table, "", profileId, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := requireField(collection, field); err != nil {
+		return nil, err
+	}
+	if err := window.apply(query, collection); err != nil {
+		return nil, err
+	}
+
+	zone := "''"
+	if collection.Fields.GetByName("timezone") != nil {
+		zone = "[[timezone]]"
+	}
+
+	var rows []struct {
+		Time string `db:"t"`
+		Zone string `db:"zone"`
+	}
+	err = query.
+		Select("[["+field+"]] AS t", "COALESCE("+zone+", '') AS zone").
+		AndWhere(dbx.NewExp("[[" + field + "]] != ''")).
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Time, 0, len(rows))
+	for _, row := range rows {
+		t, ok := parseTime(row.Time)
+		if !ok {
+			continue
+		}
+		times = append(times, localTime(t, row.Zone, fallback))
+	}
+	return times, nil
+}
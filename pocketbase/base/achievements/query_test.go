@@ -0,0 +1,428 @@
+package achievements
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The SQL evaluators replaced ones that loaded the profile's records and
+// aggregated them in Go. Those are kept here as the reference the queries
+// are checked against, and benchmarked against.
+
+// memoryRecords loads every record of the profile in the condition's table.
+func memoryRecords(app core.App, table, profileField, profileId, filter string) ([]*core.Record, error) {
+	if profileField == "" {
+		profileField = "poo_profile"
+	}
+	expr := profileField + " = {:profileId}"
+	if filter != "" {
+		expr += " && (" + filter + ")"
+	}
+	return app.FindRecordsByFilter(table, expr, "", 0, 0, dbx.Params{"profileId": profileId})
+}
+
+func memoryAggregate(app core.App, cond AggregateCondition, profileId string) (float64, bool, error) {
+	records, err := memoryRecords(app, defaultString(cond.Table, "poop_seshes"), cond.ProfileField, profileId, cond.Filter)
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch cond.Aggregation {
+	case "count":
+		return float64(len(records)), true, nil
+
+	case "count_distinct":
+		unique := make(map[string]struct{})
+		for _, r := range records {
+			if val := r.GetString(cond.Field); val != "" {
+				unique[val] = struct{}{}
+			}
+		}
+		return float64(len(unique)), true, nil
+
+	case "sum":
+		var sum float64
+		for _, r := range records {
+			sum += r.GetFloat(cond.Field)
+		}
+		return sum, true, nil
+
+	case "avg":
+		if len(records) == 0 {
+			return 0, false, nil
+		}
+		var sum float64
+		for _, r := range records {
+			sum += r.GetFloat(cond.Field)
+		}
+		return sum / float64(len(records)), true, nil
+
+	case "max_group_count":
+		groups := make(map[string]int)
+		maxCount := 0
+		for _, r := range records {
+			if val := r.GetString(cond.Field); val != "" {
+				groups[val]++
+				maxCount = max(maxCount, groups[val])
+			}
+		}
+		return float64(maxCount), true, nil
+
+	default:
+		return 0, false, fmt.Errorf("unknown aggregation type: %s", cond.Aggregation)
+	}
+}
+
+func memoryDurationStats(app core.App, cond CalculatedCondition, profileId string, thresholdSeconds float64) (durationStats, error) {
+	var stats durationStats
+	records, err := memoryRecords(app, defaultString(cond.Table, "poop_seshes"), "", profileId, "")
+	if err != nil {
+		return stats, err
+	}
+
+	first := true
+	for _, record := range records {
+		start, okStart := parseTime(record.GetString(cond.StartField))
+		end, okEnd := parseTime(record.GetString(cond.EndField))
+		if !okStart || !okEnd {
+			continue
+		}
+		duration := end.Sub(start).Seconds()
+		if matchesConditionFloat(duration, thresholdSeconds, cond.Operator) {
+			stats.Matches++
+		}
+		if first || duration > stats.Longest {
+			stats.Longest = duration
+		}
+		if first || duration < stats.Shortest {
+			stats.Shortest = duration
+		}
+		first = false
+	}
+	return stats, nil
+}
+
+// memoryHourCounts counts the profile's seshes by local hour started.
+func memoryHourCounts(app core.App, profileId string, fallback *time.Location) ([24]int, error) {
+	var counts [24]int
+	records, err := memoryRecords(app, "poop_seshes", "", profileId, "")
+	if err != nil {
+		return counts, err
+	}
+	for _, record := range records {
+		t, ok := parseTime(record.GetString("started"))
+		if !ok {
+			continue
+		}
+		counts[localTime(t, record.GetString("timezone"), fallback).Hour()]++
+	}
+	return counts, nil
+}
+
+var (
+	testCities     = []string{"", "Berlin", "Lisbon", "Osaka", "Denver", "Perth"}
+	testPlaceTypes = []string{"", "home", "work", "restaurant", "airplane"}
+	testZones      = []string{"", "Unknown", "Europe/Berlin", "America/Denver", "Asia/Tokyo", "Australia/Perth"}
+)
+
+// randomSeshes returns n seshes spread over two years, with some left open
+// and some fields left empty.
+func randomSeshes(rng *rand.Rand, n int) []sesh {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	seshes := make([]sesh, n)
+	for i := range seshes {
+		started := base.Add(time.Duration(rng.Int64N(int64(2 * 365 * 24 * time.Hour)))).Truncate(time.Millisecond)
+		s := sesh{
+			started:  started,
+			timezone: testZones[rng.IntN(len(testZones))],
+			fields: map[string]any{
+				"city":       testCities[rng.IntN(len(testCities))],
+				"place_type": testPlaceTypes[rng.IntN(len(testPlaceTypes))],
+			},
+		}
+		if rng.IntN(10) > 0 {
+			s.ended = started.Add(time.Duration(rng.Int64N(int64(90 * time.Minute)))).Truncate(time.Millisecond)
+		}
+		if rng.IntN(5) > 0 {
+			s.fields["bristol_score"] = 1 + rng.IntN(7)
+		}
+		seshes[i] = s
+	}
+	return seshes
+}
+
+// newQueryTest returns an app with a profile holding n random seshes, next
+// to another profile whose seshes must never be counted.
+func newQueryTest(t testing.TB, n int) (core.App, *core.Record) {
+	app := apptest.NewApp(t)
+	rng := rand.New(rand.NewPCG(4, uint64(n)))
+	profile := apptest.NewProfile(t, app, "measured", map[string]any{"timezone": "Europe/Lisbon"})
+	addSeshes(t, app, profile, randomSeshes(rng, n)...)
+	other := apptest.NewProfile(t, app, "other", nil)
+	addSeshes(t, app, other, randomSeshes(rng, n/4)...)
+	return app, profile
+}
+
+var aggregateCases = []AggregateCondition{
+	{Aggregation: "count"},
+	{Aggregation: "count", Filter: "bristol_score >= 5"},
+	{Aggregation: "count", Filter: "city = 'Nowhere'"},
+	{Aggregation: "count_distinct", Field: "city"},
+	{Aggregation: "count_distinct", Field: "place_type", Filter: "city != ''"},
+	{Aggregation: "sum", Field: "bristol_score"},
+	{Aggregation: "sum", Field: "bristol_score", Filter: "place_type = 'work'"},
+	{Aggregation: "avg", Field: "bristol_score"},
+	{Aggregation: "avg", Field: "bristol_score", Filter: "city = 'Osaka' || city = 'Perth'"},
+	{Aggregation: "avg", Field: "bristol_score", Filter: "city = 'Nowhere'"},
+	{Aggregation: "max_group_count", Field: "place_type"},
+	{Aggregation: "max_group_count", Field: "city", Filter: "bristol_score <= 2"},
+	{Aggregation: "max_group_count", Field: "city", Filter: "city = 'Nowhere'"},
+}
+
+func TestQueryAggregateMatchesMemory(t *testing.T) {
+	app, profile := newQueryTest(t, 400)
+
+	for _, cond := range aggregateCases {
+		name := cond.Aggregation + "(" + cond.Field + ") " + cond.Filter
+		t.Run(name, func(t *testing.T) {
+			want, wantOK, err := memoryAggregate(app, cond, profile.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := queryAggregate(app, cond, profile.Id, dateRange{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != wantOK || math.Abs(got-want) > 1e-9 {
+				t.Errorf("got %v (ok %v), in memory %v (ok %v)", got, ok, want, wantOK)
+			}
+		})
+	}
+}
+
+func TestQueryDurationStatsMatchesMemory(t *testing.T) {
+	app, profile := newQueryTest(t, 400)
+
+	for _, op := range []string{"greater_than", "greater_than_or_equal", "less_than", "less_than_or_equal", "equals"} {
+		for _, minutes := range []int{0, 5, 30, 120} {
+			cond := CalculatedCondition{StartField: "started", EndField: "ended", Operator: op, Value: minutes, Unit: "minutes"}
+			t.Run(fmt.Sprintf("%s %dm", op, minutes), func(t *testing.T) {
+				threshold := float64(toSeconds(cond.Value, cond.Unit))
+				want, err := memoryDurationStats(app, cond, profile.Id, threshold)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := queryDurationStats(app, cond, profile.Id, threshold, dateRange{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Matches != want.Matches ||
+					math.Abs(got.Longest-want.Longest) > 1e-3 ||
+					math.Abs(got.Shortest-want.Shortest) > 1e-3 {
+					t.Errorf("got %+v, in memory %+v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestQueryLocalTimesMatchesMemory(t *testing.T) {
+	app, profile := newQueryTest(t, 400)
+	fallback := loadZone(profile.GetString("timezone"))
+
+	want, err := memoryHourCounts(app, profile.Id, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times, err := queryLocalTimes(app, "poop_seshes", "started", profile.Id, fallback, dateRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [24]int
+	for _, local := range times {
+		got[local.Hour()]++
+	}
+	if got != want {
+		t.Errorf("hour counts %v, in memory %v", got, want)
+	}
+}
+
+func TestProfileQueryFilterDoesNotDuplicateRows(t *testing.T) {
+	app, profile := newQueryTest(t, 50)
+
+	// The filter joins the profile's user; counted through the id subquery
+	// every sesh still counts once.
+	cond := AggregateCondition{Aggregation: "count", Filter: "user.codeName = 'measured'"}
+	got, _, err := queryAggregate(app, cond, profile.Id, dateRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 50 {
+		t.Errorf("counted %v seshes, want 50", got)
+	}
+
+	for _, bad := range []AggregateCondition{
+		{Aggregation: "count", Table: "nope"},
+		{Aggregation: "sum", Field: "nope"},
+		{Aggregation: "count", ProfileField: "nope"},
+		{Aggregation: "count", Filter: "nope = 1"},
+		{Aggregation: "median", Field: "bristol_score"},
+	} {
+		if _, _, err := queryAggregate(app, bad, profile.Id, dateRange{}); err == nil {
+			t.Errorf("%+v: want an error", bad)
+		}
+	}
+}
+
+// Benchmarks: go test -bench . -run ^$ (with GOEXPERIMENT=nojsonv2 on Go 1.27+).
+
+func benchmarkAggregate(b *testing.B, n int, evaluate func(core.App, AggregateCondition, string) error) {
+	app, profile := newQueryTest(b, n)
+	for b.Loop() {
+		for _, cond := range aggregateCases {
+			if err := evaluate(app, cond, profile.Id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkAggregate(b *testing.B) {
+	for _, n := range []int{100, 2000} {
+		b.Run(fmt.Sprintf("sql/%d", n), func(b *testing.B) {
+			benchmarkAggregate(b, n, func(app core.App, cond AggregateCondition, profileId string) error {
+				_, _, err := queryAggregate(app, cond, profileId, dateRange{})
+				return err
+			})
+		})
+		b.Run(fmt.Sprintf("memory/%d", n), func(b *testing.B) {
+			benchmarkAggregate(b, n, func(app core.App, cond AggregateCondition, profileId string) error {
+				_, _, err := memoryAggregate(app, cond, profileId)
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkDurationStats(b *testing.B) {
+	cond := CalculatedCondition{StartField: "started", EndField: "ended", Operator: "greater_than", Value: 30, Unit: "minutes"}
+	for _, n := range []int{100, 2000} {
+		b.Run(fmt.Sprintf("sql/%d", n), func(b *testing.B) {
+			app, profile := newQueryTest(b, n)
+			for b.Loop() {
+				if _, err := queryDurationStats(app, cond, profile.Id, 1800, dateRange{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("memory/%d", n), func(b *testing.B) {
+			app, profile := newQueryTest(b, n)
+			for b.Loop() {
+				if _, err := memoryDurationStats(app, cond, profile.Id, 1800); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryLocalTimesAcrossDST(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "traveller", map[string]any{"timezone": "America/New_York"})
+	addSeshes(t, app, profile,
+		sesh{started: utc("2026-03-08T06:59:00Z"), timezone: ""},                 // profile zone, EST
+		sesh{started: utc("2026-03-08T07:00:00Z"), timezone: "Unknown"},          // profile zone, EDT
+		sesh{started: utc("2026-11-01T05:30:00Z"), timezone: "America/New_York"}, // first 01:30
+		sesh{started: utc("2026-11-01T06:30:00Z"), timezone: "America/New_York"}, // second 01:30
+		sesh{started: utc("2026-03-29T01:00:00Z"), timezone: "Europe/Berlin"},    // CEST
+		sesh{started: utc("2026-07-01T23:30:00Z"), timezone: "Asia/Tokyo"},
+	)
+
+	tests := []struct {
+		name     string
+		fallback *time.Location
+		want     []string
+	}{
+		{
+			name:     "profile zone",
+			fallback: loadZone("America/New_York"),
+			want: []string{
+				"2026-03-08 01:59 EST", "2026-03-08 03:00 EDT",
+				"2026-11-01 01:30 EDT", "2026-11-01 01:30 EST",
+				"2026-03-29 03:00 CEST", "2026-07-02 08:30 JST",
+			},
+		},
+		{
+			name: "no profile zone",
+			want: []string{
+				"2026-03-08 06:59 UTC", "2026-03-08 07:00 UTC",
+				"2026-11-01 01:30 EDT", "2026-11-01 01:30 EST",
+				"2026-03-29 03:00 CEST", "2026-07-02 08:30 JST",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times, err := queryLocalTimes(app, "poop_seshes", "started", profile.Id, tt.fallback, dateRange{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]bool, len(times))
+			for _, local := range times {
+				got[local.Format("2006-01-02 15:04 MST")] = true
+			}
+			for _, want := range tt.want {
+				if !got[want] {
+					t.Errorf("missing %s in %v", want, got)
+				}
+			}
+			if len(times) != len(tt.want) {
+				t.Errorf("got %d times, want %d", len(times), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestTimeOfDayUsesLocalHours(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "owl", map[string]any{"timezone": "Europe/London"})
+	addSeshes(t, app, profile,
+		sesh{started: utc("2026-06-01T14:30:00Z"), timezone: "Asia/Tokyo"},       // 23:30 JST
+		sesh{started: utc("2026-03-08T07:30:00Z"), timezone: "America/New_York"}, // 03:30 EDT
+		sesh{started: utc("2026-03-29T00:30:00Z")},                               // 00:30 GMT, London
+		sesh{started: utc("2026-03-29T01:30:00Z")},                               // 02:30 BST, London
+		sesh{started: utc("2026-06-01T22:30:00Z")},                               // 23:30 BST, London
+		sesh{started: utc("2026-06-01T05:00:00Z")},                               // 06:00 BST, London
+	)
+
+	tests := []struct {
+		name        string
+		start, end  int
+		wantMatches float64
+	}{
+		{"night owl 22-06", 22, 6, 5},
+		{"small hours 0-3", 0, 3, 2},
+		{"early bird 6-9", 6, 9, 1},
+		{"afternoon 12-18", 12, 18, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := newScanContext(app, profile.Id)
+			progress, err := checkTimeOfDayCondition(sc, TimeOfDayCondition{StartHour: tt.start, EndHour: tt.end, MinCount: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress.Current != tt.wantMatches {
+				t.Errorf("%v seshes in range, want %v", progress.Current, tt.wantMatches)
+			}
+		})
+	}
+}
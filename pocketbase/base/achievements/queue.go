@@ -0,0 +1,171 @@
+package achievements
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// ScanHandler is called after each successful background scan, e.g. to
+// publish newly earned achievements.
+type ScanHandler func(poopProfileId string, result *ScanResult)
+
+// ScanQueue runs achievement scans in the background.
+//
+// Scans for the same profile never overlap, so GrantAchievement cannot race
+// with itself. A profile that is already waiting in the queue is not queued
+// again: the pending scan will see every change made before it starts. A
+// request for a profile that is being scanned queues exactly one follow-up
+// scan. At most `workers` scans run at once. A scan requested through
+// EnqueueRevalidation also revalidates revocable grants; coalesced requests
+// keep that flag and the most recent triggering sesh.
+type ScanQueue struct {
+	service *AchievementService
+	handler ScanHandler
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ready   []string               // profiles waiting for a worker, in order
+	pending map[string]ScanOptions // profiles with a scan waiting to start
+	running map[string]bool        // profiles being scanned
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewScanQueue starts a queue with the given number of workers. handler may
+// be nil.
+func NewScanQueue(app *pocketbase.PocketBase, workers int, handler ScanHandler) *ScanQueue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	q := &ScanQueue{
+		service: NewAchievementService(app),
+		handler: handler,
+		pending: make(map[string]ScanOptions),
+		running: make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue requests a scan of the profile. seshId is the sesh that triggered
+// it, recorded on the grants it makes; it may be empty. Enqueue never blocks;
+// requests made after Shutdown are dropped.
+func (q *ScanQueue) Enqueue(poopProfileId, seshId string) {
+	q.enqueue(poopProfileId, ScanOptions{SeshId: seshId})
+}
+
+// EnqueueRevalidation requests a scan that also revalidates the profile's
+// revocable achievements, e.g. after one of its seshes was deleted or edited.
+func (q *ScanQueue) EnqueueRevalidation(poopProfileId, seshId string) {
+	q.enqueue(poopProfileId, ScanOptions{SeshId: seshId, Revalidate: true})
+}
+
+func (q *ScanQueue) enqueue(poopProfileId string, opts ScanOptions) {
+	if poopProfileId == "" {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		log.Printf("Achievement scan queue is shut down, dropping scan for profile %s", poopProfileId)
+		return
+	}
+	queued, ok := q.pending[poopProfileId]
+	if ok {
+		queued.Revalidate = queued.Revalidate || opts.Revalidate
+		if opts.SeshId != "" {
+			queued.SeshId = opts.SeshId
+		}
+		q.pending[poopProfileId] = queued
+		return
+	}
+	q.pending[poopProfileId] = opts
+
+	// A running scan re-queues the profile when it finishes.
+	if q.running[poopProfileId] {
+		return
+	}
+	q.ready = append(q.ready, poopProfileId)
+	q.cond.Signal()
+}
+
+// Shutdown stops accepting new requests and waits for the queued scans to
+// finish, or for ctx to be done.
+func (q *ScanQueue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *ScanQueue) work() {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		for len(q.ready) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.ready) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		profileId := q.ready[0]
+		q.ready = q.ready[1:]
+		opts := q.pending[profileId]
+		delete(q.pending, profileId)
+		q.running[profileId] = true
+		q.mu.Unlock()
+
+		q.scan(profileId, opts)
+
+		q.mu.Lock()
+		delete(q.running, profileId)
+		if _, ok := q.pending[profileId]; ok {
+			q.ready = append(q.ready, profileId)
+			q.cond.Signal()
+		}
+		q.mu.Unlock()
+	}
+}
+
+func (q *ScanQueue) scan(poopProfileId string, opts ScanOptions) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Achievement scan for profile %s panicked: %v", poopProfileId, r)
+		}
+	}()
+
+	result, err := q.service.ScanWithOptions(poopProfileId, opts)
+	if err != nil {
+		log.Printf("Error scanning achievements for profile %s: %v", poopProfileId, err)
+		return
+	}
+	if q.handler != nil {
+		q.handler(poopProfileId, result)
+	}
+}
@@ -0,0 +1,147 @@
+package achievements
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newQueueTest returns an app with a "first sesh" achievement and a profile
+// that has earned it but not been scanned yet.
+func newQueueTest(t *testing.T) (*pocketbase.PocketBase, *core.Record) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "queued", nil)
+	addSeshes(t, app, profile, sesh{started: time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)})
+	newAchievement(t, app, "First Sesh", `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}`, nil)
+	return app, profile
+}
+
+func shutdown(t *testing.T, q *ScanQueue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := q.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestScanQueueGrantsOnceUnderConcurrentEnqueues(t *testing.T) {
+	app, profile := newQueueTest(t)
+
+	var mu sync.Mutex
+	var earned []string
+	q := NewScanQueue(app, 4, func(poopProfileId string, result *ScanResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		earned = append(earned, result.Earned...)
+	})
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Enqueue(profile.Id, "")
+		}()
+	}
+	wg.Wait()
+	shutdown(t, q)
+
+	if len(earned) != 1 {
+		t.Errorf("earned %v, want one grant", earned)
+	}
+	grants, err := app.CountRecords("user_achievement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grants != 1 {
+		t.Errorf("%d user_achievement records, want 1", grants)
+	}
+}
+
+func TestScanQueueSerializesAndCoalescesPerProfile(t *testing.T) {
+	app, profile := newQueueTest(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	q := NewScanQueue(app, 4, func(string, *ScanResult) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			close(started)
+			<-release
+		}
+	})
+
+	q.Enqueue(profile.Id, "")
+	<-started
+	for range 10 {
+		q.Enqueue(profile.Id, "")
+	}
+
+	// Three workers are idle, but none may scan the profile while the first
+	// scan is still running.
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	during := calls
+	mu.Unlock()
+	if during != 1 {
+		t.Errorf("%d scans while the first was running, want 1", during)
+	}
+
+	close(release)
+	shutdown(t, q)
+	if calls != 2 {
+		t.Errorf("%d scans, want the running one and one follow-up", calls)
+	}
+}
+
+func TestScanQueueRecoversFromPanics(t *testing.T) {
+	app, profile := newQueueTest(t)
+	other := apptest.NewProfile(t, app, "other", nil)
+
+	var mu sync.Mutex
+	var scanned []string
+	q := NewScanQueue(app, 1, func(poopProfileId string, result *ScanResult) {
+		if poopProfileId == profile.Id {
+			panic("handler failed")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		scanned = append(scanned, poopProfileId)
+	})
+
+	q.Enqueue(profile.Id, "")
+	q.Enqueue(other.Id, "")
+	shutdown(t, q)
+
+	if len(scanned) != 1 || scanned[0] != other.Id {
+		t.Errorf("scanned %v after the panic, want %s", scanned, other.Id)
+	}
+}
+
+func TestScanQueueDropsRequestsAfterShutdown(t *testing.T) {
+	app, profile := newQueueTest(t)
+
+	calls := 0
+	q := NewScanQueue(app, 1, func(string, *ScanResult) { calls++ })
+	shutdown(t, q)
+	q.Enqueue(profile.Id, "")
+
+	if calls != 0 {
+		t.Errorf("%d scans after shutdown, want none", calls)
+	}
+	if grants, _ := app.CountRecords("user_achievement"); grants != 0 {
+		t.Errorf("%d grants after shutdown, want none", grants)
+	}
+}
@@ -0,0 +1,62 @@
+package achievements
+
+import (
+	"log"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// rarityCronSchedule is how often the rarity cache is refreshed.
+const rarityCronSchedule = "*/15 * * * *"
+
+// RegisterCron schedules the periodic achievement jobs and refreshes the
+// rarity cache once when the server starts.
+func RegisterCron(app *pocketbase.PocketBase) {
+	app.Cron().MustAdd("achievementRarity", rarityCronSchedule, func() {
+		if err := RefreshRarity(app); err != nil {
+			log.Printf("Error refreshing achievement rarity: %v", err)
+		}
+	})
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		go func() {
+			if err := RefreshRarity(app); err != nil {
+				log.Printf("Error refreshing achievement rarity: %v", err)
+			}
+		}()
+		return se.Next()
+	})
+}
+
+// RefreshRarity recomputes the unlock_count and unlock_percent of every
+// achievement, the latter against the number of poo profiles and rounded to
+// one decimal ("earned by 3.2% of poopers"). With no profiles every
+// percentage is 0. List them with e.g. ?sort=-unlock_percent.
+//
+// The fields are written with a single raw UPDATE, deliberately: it leaves
+// the achievements' updated dates alone and skips record hooks and realtime.
+// Saving every achievement as a record on each refresh would run the
+// achievement validation and send a realtime message per achievement for a
+// figure that moves slowly, so subscribed clients only see new values when
+// they next fetch the achievements.
+func RefreshRarity(app core.App) error {
+	var profiles int64
+	if err := app.DB().Select("COUNT(*)").From("poo_profiles").Row(&profiles); err != nil {
+		return err
+	}
+
+	unlocks := "(SELECT COUNT(*) FROM {{user_achievement}} WHERE [[achievement]] = {{achievements}}.[[id]])"
+	_, err := app.DB().NewQuery(
+		"UPDATE {{achievements}} SET " +
+			"[[unlock_count]] = " + unlocks + ", " +
+			"[[unlock_percent]] = CASE WHEN {:profiles} > 0 THEN MIN(ROUND(100.0 * " + unlocks + " / {:profiles}, 1), 100) ELSE 0 END, " +
+			"[[rarity_updated]] = {:now}",
+	).Bind(dbx.Params{
+		"profiles": profiles,
+		"now":      types.NowDateTime().String(),
+	}).Execute()
+	return err
+}
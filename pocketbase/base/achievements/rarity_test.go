@@ -0,0 +1,69 @@
+package achievements
+
+import (
+	"fmt"
+	"testing"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestRefreshRarity(t *testing.T) {
+	app := apptest.NewApp(t)
+	criteria := `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}`
+	common := newAchievement(t, app, "Common", criteria, nil)
+	rare := newAchievement(t, app, "Rare", criteria, nil)
+	twoThirds := newAchievement(t, app, "Two Thirds", criteria, nil)
+	unearned := newAchievement(t, app, "Unearned", criteria, nil)
+
+	check := func(want map[*core.Record][2]float64) {
+		t.Helper()
+		if err := RefreshRarity(app); err != nil {
+			t.Fatal(err)
+		}
+		for achievement, w := range want {
+			reloaded, err := app.FindRecordById("achievements", achievement.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, percent := reloaded.GetFloat("unlock_count"), reloaded.GetFloat("unlock_percent")
+			if count != w[0] || percent != w[1] {
+				t.Errorf("%s: %v unlocks, %v%%; want %v, %v%%", achievement.GetString("name"), count, percent, w[0], w[1])
+			}
+			if reloaded.GetDateTime("rarity_updated").IsZero() {
+				t.Errorf("%s: rarity_updated not set", achievement.GetString("name"))
+			}
+			if got, want := reloaded.GetDateTime("updated").String(), achievement.GetDateTime("updated").String(); got != want {
+				t.Errorf("%s: updated date changed from %s to %s", achievement.GetString("name"), want, got)
+			}
+		}
+	}
+
+	// No profiles yet: nothing to divide by.
+	check(map[*core.Record][2]float64{common: {0, 0}, unearned: {0, 0}})
+
+	service := NewAchievementService(app)
+	for i := range 3 {
+		profile := apptest.NewProfile(t, app, fmt.Sprintf("pooper%d", i), nil)
+		owned := []*core.Record{common}
+		if i == 0 {
+			owned = append(owned, rare)
+		}
+		if i < 2 {
+			owned = append(owned, twoThirds)
+		}
+		for _, achievement := range owned {
+			if err := service.GrantAchievement(profile.Id, achievement.Id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	check(map[*core.Record][2]float64{
+		common:    {3, 100},
+		rare:      {1, 33.3},
+		twoThirds: {2, 66.7},
+		unearned:  {0, 0},
+	})
+}
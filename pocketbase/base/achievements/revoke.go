@@ -0,0 +1,154 @@
+package achievements
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Revocation is a grant taken back, or lowered to a tier the profile still
+// qualifies for, because the seshes it was earned from changed.
+type Revocation struct {
+	AchievementId string `json:"achievementId"`
+	Removed       bool   `json:"removed"`  // the grant was deleted
+	FromTier      int    `json:"fromTier"` // tiered achievements only
+	ToTier        int    `json:"toTier"`   // tiered achievements only, 0 when removed
+	Reason        string `json:"reason"`
+}
+
+// revocableAchievements returns the active achievements flagged revocable,
+// whether or not they are currently available.
+func (s *AchievementService) revocableAchievements() ([]*core.Record, error) {
+	return s.app.FindRecordsByFilter(
+		"achievements",
+		"active = true && revocable = true && criteria != null && criteria != ''",
+		"",
+		0,
+		0,
+	)
+}
+
+// revalidate re-evaluates the profile's grants of revocable achievements and
+// removes those it no longer qualifies for. Tiered grants drop to the highest
+// tier still reached. Every change is recorded in achievement_revocations,
+// and the scan's owned records are updated to match.
+func (s *AchievementService) revalidate(sc *scanContext, opts ScanOptions, result *ScanResult) error {
+	owned, err := sc.owned()
+	if err != nil {
+		return err
+	}
+	if len(owned) == 0 {
+		return nil
+	}
+
+	achievements, err := s.revocableAchievements()
+	if err != nil {
+		return err
+	}
+	sc.stats.Queries++
+
+	for _, achievement := range achievements {
+		if opts.AchievementId != "" && achievement.Id != opts.AchievementId {
+			continue
+		}
+		grant, ok := owned[achievement.Id]
+		if !ok {
+			continue
+		}
+
+		tiers, err := parseTiers(achievement)
+		if err != nil {
+			log.Printf("Error reading tiers of achievement %s (%s): %v",
+				achievement.Id, achievement.GetString("name"), err)
+			continue
+		}
+
+		sc.stats.Revalidated++
+		progress, tier, err := evaluateAchievement(sc, achievement, tiers, 0)
+		if err != nil {
+			log.Printf("Error revalidating achievement %s (%s): %v",
+				achievement.Id, achievement.GetString("name"), err)
+			continue
+		}
+
+		ownedTier := 1
+		if len(tiers) > 0 {
+			ownedTier = ownedTierOf(grant)
+		}
+		if tier >= ownedTier {
+			continue
+		}
+
+		revocation := Revocation{
+			AchievementId: achievement.Id,
+			Removed:       tier == 0,
+			Reason:        revocationReason(tiers, tier, progress),
+		}
+		if len(tiers) > 0 {
+			revocation.FromTier, revocation.ToTier = ownedTier, tier
+		}
+
+		if !opts.DryRun {
+			if err := s.revoke(grant, revocation, progress); err != nil {
+				log.Printf("Error revoking achievement %s from profile %s: %v", achievement.Id, sc.profileId, err)
+				continue
+			}
+			log.Printf("Achievement '%s' revoked from profile %s: %s",
+				achievement.GetString("name"), sc.profileId, revocation.Reason)
+		}
+
+		if revocation.Removed {
+			delete(owned, achievement.Id)
+		} else {
+			grant.Set("tier", tier)
+		}
+		result.Revoked = append(result.Revoked, revocation)
+	}
+
+	return nil
+}
+
+// revoke deletes or downgrades the user_achievement record and writes the
+// audit entry in one transaction.
+func (s *AchievementService) revoke(grant *core.Record, revocation Revocation, progress *Progress) error {
+	collection, err := s.app.FindCachedCollectionByNameOrId("achievement_revocations")
+	if err != nil {
+		return err
+	}
+
+	entry := core.NewRecord(collection)
+	entry.Set("poo_profile", grant.GetString("poo_profile"))
+	entry.Set("achievement", revocation.AchievementId)
+	entry.Set("removed", revocation.Removed)
+	entry.Set("from_tier", revocation.FromTier)
+	entry.Set("to_tier", revocation.ToTier)
+	entry.Set("reason", revocation.Reason)
+	entry.Set("details", progress)
+	entry.Set("unlocked_at", grant.GetDateTime("unlocked_at"))
+
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		if revocation.Removed {
+			if err := txApp.Delete(grant); err != nil {
+				return err
+			}
+		} else {
+			grant.Set("tier", revocation.ToTier)
+			if err := txApp.Save(grant); err != nil {
+				return err
+			}
+		}
+		return txApp.Save(entry)
+	})
+}
+
+// revocationReason explains which criteria the profile stopped meeting. For
+// tiered achievements that is the tier above the one still reached.
+func revocationReason(tiers []Tier, reached int, progress *Progress) string {
+	what := "its criteria"
+	if reached < len(tiers) {
+		what = fmt.Sprintf("the %s tier", tiers[reached].Name)
+	}
+	return fmt.Sprintf("no longer meets %s after seshes were deleted or edited (now %g of %g)",
+		what, progress.Current, progress.Target)
+}
@@ -0,0 +1,104 @@
+package achievements
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestRevalidationAfterDeletedSeshes(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "deleter", nil)
+	seshes := addSeshes(t, app, profile, daily(time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC), 6)...)
+
+	count := func(value int) string {
+		return fmt.Sprintf(`{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": %d}`, value)
+	}
+	tiered := newAchievement(t, app, "Tiered", count(2), map[string]any{
+		"revocable": true,
+		"tiers":     `[{"name": "Bronze", "value": 2}, {"name": "Silver", "value": 5}]`,
+	})
+	plain := newAchievement(t, app, "Plain", count(4), map[string]any{"revocable": true})
+	permanent := newAchievement(t, app, "Permanent", count(4), nil)
+
+	service := NewAchievementService(app)
+	if result, err := service.Scan(profile.Id); err != nil || len(result.Earned) != 3 {
+		t.Fatalf("earned %v (%v), want all three", result.Earned, err)
+	}
+
+	for _, sesh := range seshes[3:] {
+		if err := app.Delete(sesh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	grants := func() map[string]int {
+		t.Helper()
+		records, err := app.FindAllRecords("user_achievement", dbx.HashExp{"poo_profile": profile.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tiers := make(map[string]int, len(records))
+		for _, r := range records {
+			tiers[r.GetString("achievement")] = r.GetInt("tier")
+		}
+		return tiers
+	}
+
+	// A dry run reports the revocations without making them.
+	result, err := service.ScanWithOptions(profile.Id, ScanOptions{Revalidate: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Revoked) != 2 || len(grants()) != 3 {
+		t.Errorf("dry run revoked %+v and left %v, want two reported and nothing changed", result.Revoked, grants())
+	}
+	if entries, _ := app.CountRecords("achievement_revocations"); entries != 0 {
+		t.Errorf("dry run wrote %d audit entries", entries)
+	}
+
+	result, err = service.ScanWithOptions(profile.Id, ScanOptions{Revalidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Revocation{
+		tiered.Id: {AchievementId: tiered.Id, FromTier: 2, ToTier: 1},
+		plain.Id:  {AchievementId: plain.Id, Removed: true},
+	}
+	if len(result.Revoked) != len(want) {
+		t.Fatalf("revoked %+v, want %d", result.Revoked, len(want))
+	}
+	for _, got := range result.Revoked {
+		w := want[got.AchievementId]
+		if got.Removed != w.Removed || got.FromTier != w.FromTier || got.ToTier != w.ToTier || got.Reason == "" {
+			t.Errorf("revocation %+v, want %+v with a reason", got, w)
+		}
+	}
+
+	got := grants()
+	if _, ok := got[permanent.Id]; !ok || len(got) != 2 || got[tiered.Id] != 1 {
+		t.Errorf("grants %v, want Tiered at tier 1 and the non-revocable Permanent kept", got)
+	}
+
+	entries, err := app.FindAllRecords("achievement_revocations", dbx.HashExp{"poo_profile": profile.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d audit entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		w := want[entry.GetString("achievement")]
+		if entry.GetBool("removed") != w.Removed || entry.GetInt("from_tier") != w.FromTier ||
+			entry.GetInt("to_tier") != w.ToTier || entry.GetString("reason") == "" || entry.GetDateTime("unlocked_at").IsZero() {
+			t.Errorf("audit entry for %s: removed %v, tiers %d to %d, reason %q, unlocked %v",
+				entry.GetString("achievement"), entry.GetBool("removed"), entry.GetInt("from_tier"),
+				entry.GetInt("to_tier"), entry.GetString("reason"), entry.GetDateTime("unlocked_at"))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package achievements
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterRoutes binds the achievement API routes.
+func RegisterRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	// Progress of the authenticated user towards every active achievement.
+	se.Router.GET("/api/achievements/progress", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		progress, err := NewAchievementService(app).ProfileProgress(profile.Id)
+		if err != nil {
+			return e.InternalServerError("Failed to load achievement progress.", err)
+		}
+
+		return e.JSON(http.StatusOK, progress)
+	}).Bind(apis.RequireAuth("users"))
+
+	// Running and upcoming time-limited achievements.
+	se.Router.GET("/api/achievements/events", func(e *core.RequestEvent) error {
+		profileId := ""
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err == nil {
+			profileId = profile.Id
+		}
+
+		events, err := NewAchievementService(app).Events(profileId)
+		if err != nil {
+			return e.InternalServerError("Failed to load events.", err)
+		}
+
+		return e.JSON(http.StatusOK, events)
+	}).Bind(apis.RequireAuth("users"))
+
+	// Current and best daily/weekly/monthly streaks of the authenticated user.
+	se.Router.GET("/api/streaks", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		streaks, err := NewStreakService(app).ProfileStreaks(profile.Id)
+		if err != nil {
+			return e.InternalServerError("Failed to load streaks.", err)
+		}
+
+		return e.JSON(http.StatusOK, streaks)
+	}).Bind(apis.RequireAuth("users"))
+
+	// Evaluates draft criteria without storing or granting anything.
+	se.Router.POST("/api/admin/achievements/preview", func(e *core.RequestEvent) error {
+		var body previewRequest
+		if err := e.BindBody(&body); err != nil {
+			return e.BadRequestError("Invalid request body.", err)
+		}
+
+		results, err := previewCriteria(app, body)
+		if err != nil {
+			return err
+		}
+
+		return e.JSON(http.StatusOK, results)
+	}).Bind(apis.RequireSuperuserAuth())
+}
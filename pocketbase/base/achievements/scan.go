@@ -0,0 +1,227 @@
+package achievements
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ScanStats reports the work done by one achievement scan.
+type ScanStats struct {
+	Achievements int           `json:"achievements"` // active achievements considered
+	Evaluated    int           `json:"evaluated"`    // achievements whose criteria were evaluated
+	SkippedOwned int           `json:"skippedOwned"` // skipped because the profile already owns them
+	Ineligible   int           `json:"ineligible"`   // skipped by their eligibility settings
+	Revalidated  int           `json:"revalidated"`  // owned revocable achievements re-evaluated
+	Queries      int           `json:"queries"`      // database reads issued by the scan
+	CacheHits    int           `json:"cacheHits"`    // lookups served from the scan cache
+	Duration     time.Duration `json:"duration"`
+}
+
+// Grant is an achievement unlocked, or a tier reached, during a scan.
+type Grant struct {
+	AchievementId string `json:"achievementId"`
+	Tier          int    `json:"tier"`     // tier reached, 0 for untiered achievements
+	TierName      string `json:"tierName"` // "" for untiered achievements
+	Upgrade       bool   `json:"upgrade"`  // an owned achievement moved up a tier
+}
+
+// ScanResult is the outcome of one achievement scan. Earned lists newly
+// unlocked achievements; Grants also includes tier upgrades. Revoked is only
+// filled by scans that revalidate.
+type ScanResult struct {
+	Earned  []string
+	Grants  []Grant
+	Revoked []Revocation
+	Stats   ScanStats
+}
+
+// scanContext is shared by every evaluator during one scan of one profile.
+// Each table's records are loaded at most once and query results are
+// memoised, so a condition repeated across achievements (e.g. 10/50/100 sesh
+// counts) costs a single query.
+type scanContext struct {
+	app       core.App
+	profileId string
+	now       time.Time
+	memo      map[string]any
+	stats     ScanStats
+}
+
+func newScanContext(app core.App, profileId string) *scanContext {
+	return &scanContext{
+		app:       app,
+		profileId: profileId,
+		now:       time.Now(),
+		memo:      make(map[string]any),
+	}
+}
+
+// memoize returns the value cached under key, computing and caching it with
+// load on the first call. Every load counts as one query.
+func memoize[T any](sc *scanContext, key string, load func() (T, error)) (T, error) {
+	if cached, ok := sc.memo[key]; ok {
+		sc.stats.CacheHits++
+		return cached.(T), nil
+	}
+
+	sc.stats.Queries++
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	sc.memo[key] = value
+	return value, nil
+}
+
+// profile returns the scanned poo_profiles record.
+func (sc *scanContext) profile() (*core.Record, error) {
+	return memoize(sc, "profile", func() (*core.Record, error) {
+		return sc.app.FindRecordById("poo_profiles", sc.profileId)
+	})
+}
+
+// localNow returns the scan time in the profile's default zone.
+func (sc *scanContext) localNow() (time.Time, error) {
+	profile, err := sc.profile()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return localTime(sc.now, "", loadZone(profile.GetString("timezone"))), nil
+}
+
+// records returns all of the profile's records in table.
+func (sc *scanContext) records(table string) ([]*core.Record, error) {
+	return memoize(sc, "records:"+table, func() ([]*core.Record, error) {
+		return sc.app.FindAllRecords(table, dbx.HashExp{"poo_profile": sc.profileId})
+	})
+}
+
+// owned returns the profile's user_achievement records keyed by achievement.
+func (sc *scanContext) owned() (map[string]*core.Record, error) {
+	return memoize(sc, "owned", func() (map[string]*core.Record, error) {
+		return sc.recordsByAchievement("user_achievement")
+	})
+}
+
+// progressRecords returns the profile's stored achievement_progress records
+// keyed by achievement.
+func (sc *scanContext) progressRecords() (map[string]*core.Record, error) {
+	return memoize(sc, "progress", func() (map[string]*core.Record, error) {
+		return sc.recordsByAchievement("achievement_progress")
+	})
+}
+
+func (sc *scanContext) recordsByAchievement(table string) (map[string]*core.Record, error) {
+	records, err := sc.app.FindAllRecords(table, dbx.HashExp{"poo_profile": sc.profileId})
+	if err != nil {
+		return nil, err
+	}
+	byAchievement := make(map[string]*core.Record, len(records))
+	for _, r := range records {
+		byAchievement[r.GetString("achievement")] = r
+	}
+	return byAchievement, nil
+}
+
+// aggregateValue is a memoised queryAggregate result.
+type aggregateValue struct {
+	Value float64
+	OK    bool
+}
+
+// aggregate computes cond's aggregate. The cache key leaves out the operator
+// and target so thresholds on the same aggregate share one query.
+func (sc *scanContext) aggregate(cond AggregateCondition) (aggregateValue, error) {
+	if cond.Table == "" {
+		cond.Table = "poop_seshes"
+	}
+	if cond.ProfileField == "" {
+		cond.ProfileField = "poo_profile"
+	}
+	if cond.Aggregation == "count" {
+		cond.Field = ""
+	}
+	window, err := sc.dateRange(cond.Window)
+	if err != nil {
+		return aggregateValue{}, err
+	}
+	key := fmt.Sprintf("aggregate:%s|%s|%s|%s|%s|%s", cond.Table, cond.ProfileField, cond.Filter, cond.Aggregation, cond.Field, window.key())
+	return memoize(sc, key, func() (aggregateValue, error) {
+		value, ok, err := queryAggregate(sc.app, cond, sc.profileId, window)
+		return aggregateValue{Value: value, OK: ok}, err
+	})
+}
+
+// durationStats summarises durations for cond against thresholdSeconds.
+func (sc *scanContext) durationStats(cond CalculatedCondition, thresholdSeconds float64) (durationStats, error) {
+	window, err := sc.dateRange(cond.Window)
+	if err != nil {
+		return durationStats{}, err
+	}
+	key := fmt.Sprintf("duration:%s|%s|%s|%s|%g|%s", cond.Table, cond.StartField, cond.EndField, cond.Operator, thresholdSeconds, window.key())
+	return memoize(sc, key, func() (durationStats, error) {
+		return queryDurationStats(sc.app, cond, sc.profileId, thresholdSeconds, window)
+	})
+}
+
+// localTimes returns the profile's field values in table inside window,
+// converted to the zone each record was made in; see queryLocalTimes.
+func (sc *scanContext) localTimes(table, field string, window dateRange) ([]time.Time, error) {
+	profile, err := sc.profile()
+	if err != nil {
+		return nil, err
+	}
+	fallback := loadZone(profile.GetString("timezone"))
+
+	return memoize(sc, "times:"+table+"|"+field+"|"+window.key(), func() ([]time.Time, error) {
+		return queryLocalTimes(sc.app, table, field, sc.profileId, fallback, window)
+	})
+}
+
+// streakFreezes returns the profile's streak freeze state for streakType.
+func (sc *scanContext) streakFreezes(streakType string) (streakFreezes, error) {
+	profile, err := sc.profile()
+	if err != nil {
+		return streakFreezes{}, err
+	}
+	return memoize(sc, "freezes:"+streakType, func() (streakFreezes, error) {
+		return loadStreakFreezes(sc.app, profile, streakType)
+	})
+}
+
+// simpleMatch reports whether any of the profile's records matches cond.
+func (sc *scanContext) simpleMatch(cond Condition) (bool, error) {
+	table := cond.Table
+	if table == "" {
+		table = "poop_seshes"
+	}
+	window, err := sc.dateRange(cond.Window)
+	if err != nil {
+		return false, err
+	}
+	key := fmt.Sprintf("simple:%s|%s|%s|%v|%s", table, cond.Field, cond.Operator, cond.Value, window.key())
+	return memoize(sc, key, func() (bool, error) {
+		sqlOp, err := operatorToSQL(cond.Operator)
+		if err != nil {
+			return false, err
+		}
+		filter := fmt.Sprintf("poo_profile = {:profileId} && %s %s {:value}", cond.Field, sqlOp)
+		params := dbx.Params{"profileId": sc.profileId, "value": cond.Value}
+		if !window.From.IsZero() {
+			filter += fmt.Sprintf(" && %s >= {:windowFrom}", window.Field)
+			params["windowFrom"] = formatDateTime(window.From)
+		}
+		if !window.Until.IsZero() {
+			filter += fmt.Sprintf(" && %s < {:windowUntil}", window.Field)
+			params["windowUntil"] = formatDateTime(window.Until)
+		}
+		records, err := sc.app.FindRecordsByFilter(table, filter, "-created", 1, 0, params)
+		if err != nil {
+			return false, err
+		}
+		return len(records) > 0, nil
+	})
+}
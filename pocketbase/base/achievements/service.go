@@ -1,86 +1,158 @@
 package achievements
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
-	"sort"
 	"time"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 // Condition checks a single field on a record against a value.
 type Condition struct {
-	Table    string `json:"table"`
-	Field    string `json:"field"`
-	Operator string `json:"operator"`
-	Value    any    `json:"value"`
+	Table    string      `json:"table"`
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"`
+	Value    any         `json:"value"`
+	Window   *DateWindow `json:"window,omitempty"` // only records dated inside the window count
 }
 
 // CalculatedCondition checks a computed value (e.g. session duration).
 type CalculatedCondition struct {
-	ConditionType string `json:"conditionType"`
-	Table         string `json:"table"`
-	Calculation   string `json:"calculation"` // "duration"
-	StartField    string `json:"startField"`
-	EndField      string `json:"endField"`
-	Operator      string `json:"operator"`
-	Value         int    `json:"value"`
-	Unit          string `json:"unit"` // "seconds", "minutes", "hours", "days"
+	ConditionType string      `json:"conditionType"`
+	Table         string      `json:"table"`
+	Calculation   string      `json:"calculation"` // "duration"
+	StartField    string      `json:"startField"`
+	EndField      string      `json:"endField"`
+	Operator      string      `json:"operator"`
+	Value         int         `json:"value"`
+	Unit          string      `json:"unit"` // "seconds", "minutes", "hours", "days"
+	Window        *DateWindow `json:"window,omitempty"`
 }
 
 // AggregateCondition computes an aggregate (count, sum, avg, count_distinct,
 // max_group_count) over the user's records and checks it against a threshold.
 type AggregateCondition struct {
-	ConditionType string `json:"conditionType"`
-	Table         string `json:"table"`
-	Aggregation   string `json:"aggregation"`  // count, count_distinct, sum, avg, max_group_count
-	Field         string `json:"field"`
-	Filter        string `json:"filter"`        // optional extra PocketBase filter expression
-	ProfileField  string `json:"profileField"`  // field linking to poo_profile (default: "poo_profile")
-	Operator      string `json:"operator"`
-	Value         any    `json:"value"`
+	ConditionType string      `json:"conditionType"`
+	Table         string      `json:"table"`
+	Aggregation   string      `json:"aggregation"` // count, count_distinct, sum, avg, max_group_count
+	Field         string      `json:"field"`
+	Filter        string      `json:"filter"`       // optional extra PocketBase filter expression
+	ProfileField  string      `json:"profileField"` // field linking to poo_profile (default: "poo_profile")
+	Operator      string      `json:"operator"`
+	Value         any         `json:"value"`
+	Window        *DateWindow `json:"window,omitempty"`
 }
 
 // StreakCondition checks for consecutive daily/weekly/monthly activity.
+// Periods follow the local calendar of the zone each sesh was logged in.
 type StreakCondition struct {
-	ConditionType      string `json:"conditionType"`
-	Table              string `json:"table"`
-	StreakType         string `json:"streakType"`         // "daily", "weekly", "monthly"
-	DateField          string `json:"dateField"`
-	ConsecutiveCount   int    `json:"consecutiveCount"`
-	MinEventsPerPeriod int    `json:"minEventsPerPeriod"`
+	ConditionType      string      `json:"conditionType"`
+	Table              string      `json:"table"`
+	StreakType         string      `json:"streakType"` // "daily", "weekly", "monthly"
+	DateField          string      `json:"dateField"`
+	ConsecutiveCount   int         `json:"consecutiveCount"`
+	MinEventsPerPeriod int         `json:"minEventsPerPeriod"`
+	Mode               string      `json:"mode"`        // "longest" (default) or "current": only a streak still active counts
+	AllowedGaps        int         `json:"allowedGaps"` // missed periods tolerated...
+	GapWindow          int         `json:"gapWindow"`   // ...per this many periods (0: per streak)
+	Window             *DateWindow `json:"window,omitempty"`
 }
 
 // GeoProximityCondition checks whether seshes occurred near a geographical
-// feature (e.g. ocean) by querying an external tile API per sesh location.
-// The Mapbox access token must be in the MAPBOX_ACCESS_TOKEN env var.
+// feature (e.g. ocean), as answered by the configured GeoFeatureProvider.
 type GeoProximityCondition struct {
-	ConditionType string `json:"conditionType"` // "ocean_proximity"
-	Table         string `json:"table"`
-	LocationField string `json:"locationField"` // geoPoint field, default "location"
-	MinCount      int    `json:"minCount"`       // minimum matching seshes (default 1)
+	ConditionType string      `json:"conditionType"` // "ocean_proximity"
+	Table         string      `json:"table"`
+	LocationField string      `json:"locationField"` // geoPoint field, default "location"
+	RadiusMeters  int         `json:"radiusMeters"`  // default 1609 (one mile)
+	MinCount      int         `json:"minCount"`      // minimum matching seshes (default 1)
+	Window        *DateWindow `json:"window,omitempty"`
+}
+
+// DistinctPlacesCondition counts the distinct countries, regions or cities
+// seshes were logged in, from their country/region/city fields. Regions are
+// told apart by country and cities by region and country, so Georgia the
+// state and Georgia the country are two places.
+type DistinctPlacesCondition struct {
+	ConditionType string      `json:"conditionType"` // "distinct_places"
+	Table         string      `json:"table"`
+	Level         string      `json:"level"`    // "country" (default), "region" or "city"
+	MinCount      int         `json:"minCount"` // minimum distinct places (default 1)
+	Window        *DateWindow `json:"window,omitempty"`
+}
+
+// TravelDistanceCondition checks the largest great-circle distance between
+// the locations of any two seshes.
+type TravelDistanceCondition struct {
+	ConditionType string      `json:"conditionType"` // "travel_distance"
+	Table         string      `json:"table"`
+	LocationField string      `json:"locationField"` // geoPoint field, default "location"
+	MinKilometers float64     `json:"minKilometers"`
+	Window        *DateWindow `json:"window,omitempty"`
+}
+
+// GeoPolygonCondition counts seshes inside an admin-defined area (a national
+// park, a stadium), given as a GeoJSON Polygon, MultiPolygon, Feature or
+// FeatureCollection.
+type GeoPolygonCondition struct {
+	ConditionType string          `json:"conditionType"` // "geo_polygon"
+	Table         string          `json:"table"`
+	LocationField string          `json:"locationField"` // geoPoint field, default "location"
+	Area          json.RawMessage `json:"area"`
+	MinCount      int             `json:"minCount"` // minimum matching seshes (default 1)
+	Window        *DateWindow     `json:"window,omitempty"`
+}
+
+// HomeDistanceCondition counts seshes at least MinKilometers away from the
+// profile's home, the densest cluster of all its sesh locations. The window
+// only limits the seshes counted, never the ones home is found from.
+type HomeDistanceCondition struct {
+	ConditionType string      `json:"conditionType"` // "home_distance"
+	Table         string      `json:"table"`
+	LocationField string      `json:"locationField"` // geoPoint field, default "location"
+	MinKilometers float64     `json:"minKilometers"`
+	MinCount      int         `json:"minCount"` // minimum matching seshes (default 1)
+	Window        *DateWindow `json:"window,omitempty"`
+}
+
+// AltitudeCondition counts seshes logged between MinMeters and MaxMeters
+// above sea level (either may be left out), e.g. above 3,000m in the
+// mountains or below sea level by the Dead Sea. Seshes whose device reported
+// no altitude store 0 and never count.
+type AltitudeCondition struct {
+	ConditionType string      `json:"conditionType"` // "altitude"
+	Table         string      `json:"table"`
+	Field         string      `json:"field"` // number field, default "altitude"
+	MinMeters     *float64    `json:"minMeters,omitempty"`
+	MaxMeters     *float64    `json:"maxMeters,omitempty"`
+	MinCount      int         `json:"minCount"` // minimum matching seshes (default 1)
+	Window        *DateWindow `json:"window,omitempty"`
 }
 
 // TimeOfDayCondition checks how many seshes started in a given hour range.
-// When startHour > endHour the range wraps midnight (e.g. 22–06).
+// When startHour > endHour the range wraps midnight (e.g. 22–06). Hours are
+// local to the sesh's timezone, or the profile's default zone when the sesh
+// has none.
 type TimeOfDayCondition struct {
-	ConditionType string `json:"conditionType"`
-	Table         string `json:"table"`
-	Field         string `json:"field"`     // datetime field, default "started"
-	StartHour     int    `json:"startHour"` // inclusive, 0-23
-	EndHour       int    `json:"endHour"`   // exclusive, 0-23
-	MinCount      int    `json:"minCount"`  // minimum matching seshes required (default 1)
-}
-
-// Criteria is the top-level structure stored in the achievement's criteria JSON
-// field. All conditions are AND-ed together.
+	ConditionType string      `json:"conditionType"`
+	Table         string      `json:"table"`
+	Field         string      `json:"field"`     // datetime field, default "started"
+	StartHour     int         `json:"startHour"` // inclusive, 0-23
+	EndHour       int         `json:"endHour"`   // exclusive, 0-23
+	MinCount      int         `json:"minCount"`  // minimum matching seshes required (default 1)
+	Window        *DateWindow `json:"window,omitempty"`
+}
+
+// Criteria is the legacy flat format of the achievement's criteria JSON field:
+// every condition is decoded as Type and all of them are AND-ed together.
+// ParseCriteria converts it into a CriteriaNode tree.
 type Criteria struct {
 	Type       string            `json:"type"`
 	Conditions []json.RawMessage `json:"conditions"`
@@ -95,193 +167,348 @@ func NewAchievementService(app *pocketbase.PocketBase) *AchievementService {
 	return &AchievementService{app: app}
 }
 
-// AchievementScan evaluates all active achievements for the given poo profile
-// and grants any that are newly earned. Returns IDs of newly granted achievements.
+// AchievementScan evaluates all active achievements the given poo profile is
+// eligible for and grants any that are newly earned. Returns IDs of newly
+// granted achievements.
 func (s *AchievementService) AchievementScan(poopProfileId string) ([]string, error) {
-	earnedAchievements := []string{}
+	result, err := s.Scan(poopProfileId)
+	if err != nil {
+		return []string{}, err
+	}
+	return result.Earned, nil
+}
+
+// ScanOptions narrows or neutralises a scan.
+type ScanOptions struct {
+	// AchievementId restricts the scan to a single achievement.
+	AchievementId string
+	// DryRun evaluates without storing progress or granting anything;
+	// Earned and Grants then list what would have been granted.
+	DryRun bool
+	// Revalidate first re-evaluates the profile's revocable achievements
+	// and revokes those it no longer qualifies for, e.g. after seshes were
+	// deleted or edited.
+	Revalidate bool
+	// SeshId is the sesh that triggered the scan. It is stored on the
+	// grants the scan makes; ignored when the sesh no longer exists.
+	SeshId string
+	// Quiet saves the grants without notifying the profile, see IsQuiet.
+	Quiet bool
+}
+
+// Scan is AchievementScan with the scan's statistics.
+func (s *AchievementService) Scan(poopProfileId string) (*ScanResult, error) {
+	return s.ScanWithOptions(poopProfileId, ScanOptions{})
+}
+
+// ScanWithOptions scans the profile as configured by opts. Achievements the
+// profile already owns (at their top tier) are skipped before their criteria
+// are parsed; owned tiered achievements are only evaluated from the next
+// tier up and are upgraded in place when it is reached. All
+// remaining ones are evaluated against a single scanContext so records and
+// query results are shared between them.
+func (s *AchievementService) ScanWithOptions(poopProfileId string, opts ScanOptions) (*ScanResult, error) {
+	started := time.Now()
+	result := &ScanResult{Earned: []string{}, Grants: []Grant{}, Revoked: []Revocation{}}
+	sc := newScanContext(s.app, poopProfileId)
+
+	facts, err := sc.profileFacts()
+	if err != nil {
+		return result, err
+	}
 
-	seshes, err := s.app.FindAllRecords("poop_seshes",
-		dbx.NewExp("poo_profile = {:id}", dbx.Params{"id": poopProfileId}))
+	owned, err := sc.owned()
 	if err != nil {
-		return earnedAchievements, fmt.Errorf("getting seshes: %w", err)
+		return result, fmt.Errorf("getting owned achievements: %w", err)
 	}
 
-	if len(seshes) < 10 {
-		log.Printf("Profile %s has %d seshes, skipping achievement scan (minimum 10)", poopProfileId, len(seshes))
-		return earnedAchievements, nil
+	if opts.Revalidate {
+		if err := s.revalidate(sc, opts, result); err != nil {
+			return result, fmt.Errorf("revalidating achievements: %w", err)
+		}
 	}
 
-	achievements, err := s.app.FindRecordsByFilter(
-		"achievements",
-		"active = true && criteria != null && criteria != ''",
-		"",
-		1000,
-		0,
-	)
+	if opts.SeshId != "" && !opts.DryRun {
+		sc.stats.Queries++
+		sesh, err := s.app.FindRecordById("poop_seshes", opts.SeshId)
+		if err != nil || sesh.GetString("poo_profile") != poopProfileId {
+			opts.SeshId = ""
+		}
+	}
+
+	achievements, err := s.activeAchievements()
 	if err != nil {
-		return earnedAchievements, fmt.Errorf("getting achievements: %w", err)
+		return result, fmt.Errorf("getting achievements: %w", err)
 	}
+	sc.stats.Queries++
 
+	now := time.Now()
 	for _, achievement := range achievements {
-		criteriaStr := achievement.GetString("criteria")
-		if criteriaStr == "" || criteriaStr == "null" {
+		if opts.AchievementId != "" && achievement.Id != opts.AchievementId {
 			continue
 		}
+		sc.stats.Achievements++
 
-		var criteria Criteria
-		if err := json.Unmarshal([]byte(criteriaStr), &criteria); err != nil {
-			log.Printf("Error parsing criteria for achievement %s: %v", achievement.Id, err)
+		tiers, err := parseTiers(achievement)
+		if err != nil {
+			log.Printf("Error reading tiers of achievement %s (%s): %v",
+				achievement.Id, achievement.GetString("name"), err)
+			continue
+		}
+
+		ownedTier := 0
+		if record, ok := owned[achievement.Id]; ok {
+			ownedTier = ownedTierOf(record)
+			if ownedTier >= max(len(tiers), 1) {
+				sc.stats.SkippedOwned++
+				continue
+			}
+		}
+
+		if ok, reason := eligibilityFromRecord(achievement).check(facts, now); !ok {
+			sc.stats.Ineligible++
+			log.Printf("Profile %s not eligible for achievement %s: %s", poopProfileId, achievement.Id, reason)
 			continue
 		}
 
-		matched, err := s.evaluateCriteria(criteria, poopProfileId)
+		sc.stats.Evaluated++
+		progress, tier, err := evaluateAchievement(sc, achievement, tiers, ownedTier)
 		if err != nil {
 			log.Printf("Error evaluating criteria for achievement %s (%s): %v",
 				achievement.Id, achievement.GetString("name"), err)
 			continue
 		}
 
-		if !matched {
-			continue
+		grant := Grant{
+			AchievementId: achievement.Id,
+			TierName:      tierName(tiers, tier),
+			Upgrade:       ownedTier > 0,
+		}
+		if len(tiers) > 0 {
+			grant.Tier = tier
 		}
 
-		if err := s.GrantAchievement(poopProfileId, achievement.Id); err != nil {
-			log.Printf("Error granting achievement %s: %v", achievement.Id, err)
+		if opts.DryRun {
+			if tier > ownedTier {
+				result.addGrant(grant)
+			}
 			continue
 		}
 
-		earnedAchievements = append(earnedAchievements, achievement.Id)
-		log.Printf("Achievement '%s' earned by profile %s", achievement.GetString("name"), poopProfileId)
-	}
+		if err := s.saveProgress(sc, achievement.Id, progress); err != nil {
+			log.Printf("Error saving progress for achievement %s: %v", achievement.Id, err)
+		}
 
-	return earnedAchievements, nil
-}
+		if tier <= ownedTier {
+			continue
+		}
 
-// evaluateCriteria checks all conditions in the criteria (AND logic).
-// Returns true only when every condition is satisfied.
-func (s *AchievementService) evaluateCriteria(criteria Criteria, poopProfileId string) (bool, error) {
-	if len(criteria.Conditions) == 0 {
-		return false, nil
+		details := GrantDetails{
+			Tier:   grant.Tier,
+			SeshId: opts.SeshId,
+			Quiet:  opts.Quiet,
+			Snapshot: &GrantSnapshot{
+				EvaluatedAt: types.NowDateTime(),
+				Tier:        grant.Tier,
+				TierName:    grant.TierName,
+				Progress:    reachedProgress(sc, achievement, tiers, tier, progress),
+			},
+		}
+		if grant.Upgrade {
+			err = s.UpgradeAchievement(poopProfileId, achievement.Id, details)
+		} else {
+			err = s.GrantAchievementWith(poopProfileId, achievement.Id, details)
+		}
+		if err != nil {
+			if !errors.Is(err, ErrAlreadyOwned) {
+				log.Printf("Error granting achievement %s: %v", achievement.Id, err)
+			}
+			continue
+		}
+
+		result.addGrant(grant)
+		if grant.Upgrade {
+			log.Printf("Achievement '%s' upgraded to %s for profile %s", achievement.GetString("name"), grant.TierName, poopProfileId)
+		} else {
+			log.Printf("Achievement '%s' earned by profile %s", achievement.GetString("name"), poopProfileId)
+		}
 	}
 
-	for _, rawCond := range criteria.Conditions {
-		var matched bool
-		var err error
+	sc.stats.Duration = time.Since(started)
+	result.Stats = sc.stats
+	log.Printf("Achievement scan for profile %s: %d achievements, %d evaluated, %d owned, %d ineligible, %d earned, %d upgraded, %d revoked; %d queries, %d cache hits in %s",
+		poopProfileId, sc.stats.Achievements, sc.stats.Evaluated, sc.stats.SkippedOwned, sc.stats.Ineligible,
+		len(result.Earned), len(result.Grants)-len(result.Earned), len(result.Revoked), sc.stats.Queries, sc.stats.CacheHits, sc.stats.Duration)
 
-		switch criteria.Type {
-		case "simple":
-			var cond Condition
-			if err = json.Unmarshal(rawCond, &cond); err != nil {
-				return false, fmt.Errorf("parsing simple condition: %w", err)
-			}
-			matched, err = s.checkSimpleCondition(cond, poopProfileId)
+	return result, nil
+}
 
-		case "calculated":
-			var cond CalculatedCondition
-			if err = json.Unmarshal(rawCond, &cond); err != nil {
-				return false, fmt.Errorf("parsing calculated condition: %w", err)
-			}
-			matched, err = s.checkCalculatedCondition(cond, poopProfileId)
+// activeAchievements returns every active achievement that has criteria and
+// is currently available: events that have not started or have ended are
+// left out.
+func (s *AchievementService) activeAchievements() ([]*core.Record, error) {
+	records, err := s.app.FindRecordsByFilter(
+		"achievements",
+		"active = true && criteria != null && criteria != '' && "+availableNowFilter,
+		"",
+		1000,
+		0,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		case "aggregate":
-			var cond AggregateCondition
-			if err = json.Unmarshal(rawCond, &cond); err != nil {
-				return false, fmt.Errorf("parsing aggregate condition: %w", err)
-			}
-			matched, err = checkAggregateCondition(s.app, cond, poopProfileId)
+	achievements := make([]*core.Record, 0, len(records))
+	for _, record := range records {
+		criteriaStr := record.GetString("criteria")
+		if criteriaStr == "" || criteriaStr == "null" {
+			continue
+		}
+		achievements = append(achievements, record)
+	}
+	return achievements, nil
+}
 
-		case "streak":
-			var cond StreakCondition
-			if err = json.Unmarshal(rawCond, &cond); err != nil {
-				return false, fmt.Errorf("parsing streak condition: %w", err)
-			}
-			matched, err = checkStreakCondition(s.app, cond, poopProfileId)
+// evaluateAchievement parses the achievement's criteria and evaluates them for
+// the scan's profile, returning the progress and the tier reached. Untiered
+// achievements reach tier 1 when their criteria are met; tiered ones are
+// evaluated from the tier after fromTier and report progress towards the
+// next tier.
+func evaluateAchievement(sc *scanContext, achievement *core.Record, tiers []Tier, fromTier int) (*Progress, int, error) {
+	criteria, err := ParseCriteria([]byte(achievement.GetString("criteria")))
+	if err != nil {
+		return nil, 0, fmt.Errorf("parsing criteria: %w", err)
+	}
+	return evaluateTiered(sc, criteria, tiers, fromTier)
+}
 
-		case "time_of_day":
-			var cond TimeOfDayCondition
-			if err = json.Unmarshal(rawCond, &cond); err != nil {
-				return false, fmt.Errorf("parsing time_of_day condition: %w", err)
-			}
-			matched, err = checkTimeOfDayCondition(s.app, cond, poopProfileId)
+// evaluateTiered evaluates parsed criteria and tiers; see evaluateAchievement.
+func evaluateTiered(sc *scanContext, criteria *CriteriaNode, tiers []Tier, fromTier int) (*Progress, int, error) {
+	if len(tiers) > 0 {
+		return evaluateTiers(sc, criteria, tiers, fromTier)
+	}
 
-		case "geo_proximity":
-			var cond GeoProximityCondition
-			if err = json.Unmarshal(rawCond, &cond); err != nil {
-				return false, fmt.Errorf("parsing geo_proximity condition: %w", err)
-			}
-			matched, err = checkGeoProximityCondition(s.app, cond, poopProfileId)
+	progress, err := evaluateCriteria(sc, criteria)
+	if err != nil {
+		return nil, 0, err
+	}
+	if progress.Met {
+		return progress, 1, nil
+	}
+	return progress, 0, nil
+}
 
-		default:
-			return false, fmt.Errorf("unknown criteria type: %s", criteria.Type)
+// evaluateCriteria evaluates a criteria tree for the scan's profile. Every
+// node is evaluated so the result reports progress for the whole tree; an
+// empty group never matches.
+func evaluateCriteria(sc *scanContext, node *CriteriaNode) (*Progress, error) {
+	if node.IsLeaf() {
+		progress, err := evaluateCondition(sc, node.Condition)
+		if err != nil {
+			return nil, err
 		}
+		progress.ConditionType = node.ConditionType
+		return progress, nil
+	}
+
+	switch node.Group {
+	case GroupAll, GroupAny, GroupNone:
+	default:
+		return nil, fmt.Errorf("unknown criteria group: %s", node.Group)
+	}
 
+	children := make([]*Progress, 0, len(node.Children))
+	for _, child := range node.Children {
+		progress, err := evaluateCriteria(sc, child)
 		if err != nil {
-			return false, err
-		}
-		if !matched {
-			return false, nil
+			return nil, err
 		}
+		children = append(children, progress)
+	}
+
+	return groupProgress(node.Group, children), nil
+}
+
+// evaluateCondition dispatches a single leaf condition to its evaluator.
+func evaluateCondition(sc *scanContext, condition any) (*Progress, error) {
+	switch cond := condition.(type) {
+	case Condition:
+		return checkSimpleCondition(sc, cond)
+	case CalculatedCondition:
+		return checkCalculatedCondition(sc, cond)
+	case AggregateCondition:
+		return checkAggregateCondition(sc, cond)
+	case StreakCondition:
+		return checkStreakCondition(sc, cond)
+	case TimeOfDayCondition:
+		return checkTimeOfDayCondition(sc, cond)
+	case GeoProximityCondition:
+		return checkGeoProximityCondition(sc, cond)
+	case DistinctPlacesCondition:
+		return checkDistinctPlacesCondition(sc, cond)
+	case TravelDistanceCondition:
+		return checkTravelDistanceCondition(sc, cond)
+	case GeoPolygonCondition:
+		return checkGeoPolygonCondition(sc, cond)
+	case HomeDistanceCondition:
+		return checkHomeDistanceCondition(sc, cond)
+	case AltitudeCondition:
+		return checkAltitudeCondition(sc, cond)
+	default:
+		return nil, fmt.Errorf("unsupported condition %T", condition)
 	}
-
-	return true, nil
 }
 
 // checkSimpleCondition checks whether at least one of the user's records matches
-// the given field/operator/value.
-func (s *AchievementService) checkSimpleCondition(cond Condition, poopProfileId string) (bool, error) {
-	table := cond.Table
-	if table == "" {
-		table = "poop_seshes"
-	}
-	sqlOp, err := operatorToSQL(cond.Operator)
+// the given field/operator/value. Progress is 0 or 1 matching record.
+func checkSimpleCondition(sc *scanContext, cond Condition) (*Progress, error) {
+	matched, err := sc.simpleMatch(cond)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	filter := fmt.Sprintf("poo_profile = {:profileId} && %s %s {:value}", cond.Field, sqlOp)
-	records, err := s.app.FindRecordsByFilter(
-		table, filter, "-created", 1, 0,
-		dbx.Params{"profileId": poopProfileId, "value": cond.Value},
-	)
-	if err != nil {
-		return false, err
+	current := 0.0
+	if matched {
+		current = 1
 	}
-	return len(records) > 0, nil
+	return newProgress(current, 1, "greater_than_or_equal"), nil
 }
 
-// checkCalculatedCondition fetches completed seshes and evaluates duration in Go.
-func (s *AchievementService) checkCalculatedCondition(cond CalculatedCondition, poopProfileId string) (bool, error) {
-	table := cond.Table
-	if table == "" {
-		table = "poop_seshes"
+// checkCalculatedCondition computes session durations in SQL.
+// Progress reports the best duration so far in cond.Unit: the longest for
+// greater_than* operators, the shortest for less_than* ones. For equals and
+// not_equals it is the number of matching seshes against a target of 1.
+func checkCalculatedCondition(sc *scanContext, cond CalculatedCondition) (*Progress, error) {
+	if cond.StartField == "" {
+		cond.StartField = "started"
 	}
-
-	records, err := s.app.FindRecordsByFilter(
-		table,
-		"poo_profile = {:profileId} && ended != null && ended != ''",
-		"",
-		10000,
-		0,
-		dbx.Params{"profileId": poopProfileId},
-	)
-	if err != nil {
-		return false, err
+	if cond.EndField == "" {
+		cond.EndField = "ended"
 	}
 
 	thresholdSeconds := float64(toSeconds(cond.Value, cond.Unit))
+	unitSeconds := float64(toSeconds(1, cond.Unit))
 
-	for _, record := range records {
-		start, okStart := parseTime(record.GetString(cond.StartField))
-		end, okEnd := parseTime(record.GetString(cond.EndField))
-		if !okStart || !okEnd {
-			continue
-		}
-		duration := end.Sub(start).Seconds()
-		if matchesConditionFloat(duration, thresholdSeconds, cond.Operator) {
-			return true, nil
-		}
+	stats, err := sc.durationStats(cond, thresholdSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	var best float64
+	switch cond.Operator {
+	case "greater_than", "greater_than_or_equal":
+		best = stats.Longest
+	case "less_than", "less_than_or_equal":
+		best = stats.Shortest
+	default:
+		return newProgress(float64(stats.Matches), 1, "greater_than_or_equal"), nil
 	}
 
-	return false, nil
+	return &Progress{
+		Operator: cond.Operator,
+		Current:  best / unitSeconds,
+		Target:   float64(cond.Value),
+		Met:      stats.Matches > 0,
+	}, nil
 }
 
 // UserHasAchievement checks whether the profile already owns the achievement.
@@ -300,14 +527,75 @@ func (s *AchievementService) UserHasAchievement(poopProfileId string, achievemen
 	return len(records) > 0, nil
 }
 
-// GrantAchievement awards an achievement to a profile if not already owned.
+// ErrAlreadyOwned is returned by GrantAchievement when the profile already
+// owns the achievement, and by UpgradeAchievement when it owns the tier.
+var ErrAlreadyOwned = errors.New("achievement already owned")
+
+// GrantAchievement awards an untiered achievement to a profile, together
+// with the streak freezes the achievement rewards. It returns
+// ErrAlreadyOwned if the profile owns it already, including when a concurrent
+// grant wins the unique (poo_profile, achievement) index.
 func (s *AchievementService) GrantAchievement(poopProfileId string, achievementId string) error {
+	return s.GrantAchievementWith(poopProfileId, achievementId, GrantDetails{})
+}
+
+// GrantDetails describes a grant: the tier reached, the sesh that triggered
+// it and the evaluation it was made on.
+type GrantDetails struct {
+	Tier     int // 0 for untiered achievements
+	SeshId   string
+	Snapshot *GrantSnapshot
+	Quiet    bool // don't notify the profile, e.g. when backfilling
+}
+
+// GrantSnapshot is the evaluation stored on a grant, so support can explain
+// it later.
+type GrantSnapshot struct {
+	EvaluatedAt types.DateTime `json:"evaluatedAt"`
+	Tier        int            `json:"tier,omitempty"`
+	TierName    string         `json:"tierName,omitempty"`
+	Progress    *Progress      `json:"progress"`
+}
+
+// apply sets the details on a user_achievement record. An upgrade without a
+// triggering sesh keeps the one stored before.
+func (d GrantDetails) apply(record *core.Record) {
+	record.Set("tier", d.Tier)
+	if d.SeshId != "" {
+		record.Set("poop_sesh", d.SeshId)
+	}
+	if d.Snapshot != nil {
+		record.Set("snapshot", d.Snapshot)
+	}
+}
+
+// quietKey marks the context a quiet grant is saved with.
+type quietKey struct{}
+
+// context returns the context to save the grant's record with.
+func (d GrantDetails) context() context.Context {
+	if d.Quiet {
+		return context.WithValue(context.Background(), quietKey{}, true)
+	}
+	return context.Background()
+}
+
+// IsQuiet reports whether a user_achievement record is being saved by a
+// grant the profile should not be notified about. Record hooks pass their
+// event's context.
+func IsQuiet(ctx context.Context) bool {
+	quiet, _ := ctx.Value(quietKey{}).(bool)
+	return quiet
+}
+
+// GrantAchievementWith is GrantAchievement storing the grant's details.
+func (s *AchievementService) GrantAchievementWith(poopProfileId string, achievementId string, details GrantDetails) error {
 	has, err := s.UserHasAchievement(poopProfileId, achievementId)
 	if err != nil {
 		return err
 	}
 	if has {
-		return nil
+		return ErrAlreadyOwned
 	}
 
 	collection, err := s.app.FindCollectionByNameOrId("user_achievement")
@@ -319,93 +607,72 @@ func (s *AchievementService) GrantAchievement(poopProfileId string, achievementI
 	record.Set("poo_profile", poopProfileId)
 	record.Set("achievement", achievementId)
 	record.Set("unlocked_at", time.Now().Format(time.RFC3339))
+	details.apply(record)
+
+	achievement, err := s.app.FindRecordById("achievements", achievementId)
+	if err != nil {
+		return err
+	}
+
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		if err := txApp.SaveWithContext(details.context(), record); err != nil {
+			return err
+		}
+		return awardStreakFreezes(txApp, poopProfileId, achievement.GetInt("streak_freeze_reward"))
+	})
+	if err != nil {
+		if has, _ := s.UserHasAchievement(poopProfileId, achievementId); has {
+			return ErrAlreadyOwned
+		}
+		return err
+	}
+	return nil
+}
+
+// UpgradeAchievement raises the tier of an achievement the profile owns to
+// details.Tier, replacing the stored sesh and snapshot. It returns
+// ErrAlreadyOwned if the profile already holds that tier or a higher one.
+func (s *AchievementService) UpgradeAchievement(poopProfileId string, achievementId string, details GrantDetails) error {
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := txApp.FindFirstRecordByFilter(
+			"user_achievement",
+			"poo_profile = {:profileId} && achievement = {:achievementId}",
+			dbx.Params{"profileId": poopProfileId, "achievementId": achievementId},
+		)
+		if err != nil {
+			return err
+		}
+		if ownedTierOf(record) >= details.Tier {
+			return ErrAlreadyOwned
+		}
 
-	return s.app.Save(record)
+		details.apply(record)
+		return txApp.SaveWithContext(details.context(), record)
+	})
 }
 
 // ---------------------------------------------------------------------------
 // Aggregate condition
 // ---------------------------------------------------------------------------
 
-func checkAggregateCondition(app *pocketbase.PocketBase, cond AggregateCondition, pooProfileId string) (bool, error) {
-	table := cond.Table
-	if table == "" {
-		table = "poop_seshes"
-	}
-	profileField := cond.ProfileField
-	if profileField == "" {
-		profileField = "poo_profile"
-	}
-
-	filter := fmt.Sprintf("%s = '%s'", profileField, pooProfileId)
-	if cond.Filter != "" {
-		filter = filter + " && " + cond.Filter
-	}
-
-	records, err := app.FindRecordsByFilter(table, filter, "", 10000, 0)
+func checkAggregateCondition(sc *scanContext, cond AggregateCondition) (*Progress, error) {
+	aggregate, err := sc.aggregate(cond)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	targetValue := toFloat64(cond.Value)
-
-	switch cond.Aggregation {
-	case "count":
-		return matchesConditionFloat(float64(len(records)), targetValue, cond.Operator), nil
-
-	case "count_distinct":
-		unique := make(map[string]struct{})
-		for _, r := range records {
-			if val := r.GetString(cond.Field); val != "" {
-				unique[val] = struct{}{}
-			}
-		}
-		return matchesConditionFloat(float64(len(unique)), targetValue, cond.Operator), nil
-
-	case "sum":
-		var sum float64
-		for _, r := range records {
-			sum += r.GetFloat(cond.Field)
-		}
-		return matchesConditionFloat(sum, targetValue, cond.Operator), nil
-
-	case "avg":
-		if len(records) == 0 {
-			return false, nil
-		}
-		var sum float64
-		for _, r := range records {
-			sum += r.GetFloat(cond.Field)
-		}
-		return matchesConditionFloat(sum/float64(len(records)), targetValue, cond.Operator), nil
-
-	// max_group_count: find the highest per-value count across all records.
-	// Useful for "creature of habit" (largest number of seshes at same place).
-	case "max_group_count":
-		groups := make(map[string]int)
-		for _, r := range records {
-			if val := r.GetString(cond.Field); val != "" {
-				groups[val]++
-			}
-		}
-		maxCount := 0
-		for _, count := range groups {
-			if count > maxCount {
-				maxCount = count
-			}
-		}
-		return matchesConditionFloat(float64(maxCount), targetValue, cond.Operator), nil
-
-	default:
-		return false, fmt.Errorf("unknown aggregation type: %s", cond.Aggregation)
+	if !aggregate.OK {
+		return &Progress{Operator: cond.Operator, Target: targetValue}, nil
 	}
+	return newProgress(aggregate.Value, targetValue, cond.Operator), nil
 }
 
 // ---------------------------------------------------------------------------
 // Time-of-day condition
 // ---------------------------------------------------------------------------
 
-func checkTimeOfDayCondition(app *pocketbase.PocketBase, cond TimeOfDayCondition, pooProfileId string) (bool, error) {
+func checkTimeOfDayCondition(sc *scanContext, cond TimeOfDayCondition) (*Progress, error) {
 	table := cond.Table
 	if table == "" {
 		table = "poop_seshes"
@@ -419,62 +686,74 @@ func checkTimeOfDayCondition(app *pocketbase.PocketBase, cond TimeOfDayCondition
 		minCount = 1
 	}
 
-	records, err := app.FindRecordsByFilter(
-		table,
-		fmt.Sprintf("poo_profile = '%s'", pooProfileId),
-		"",
-		10000,
-		0,
-	)
+	window, err := sc.dateRange(cond.Window)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	times, err := sc.localTimes(table, field, window)
+	if err != nil {
+		return nil, err
 	}
 
 	count := 0
-	for _, record := range records {
-		t, ok := parseTime(record.GetString(field))
-		if !ok {
-			continue
-		}
+	for _, t := range times {
 		if isHourInRange(t.Hour(), cond.StartHour, cond.EndHour) {
 			count++
 		}
 	}
 
-	return count >= minCount, nil
+	return newProgress(float64(count), float64(minCount), "greater_than_or_equal"), nil
 }
 
 // ---------------------------------------------------------------------------
 // Streak condition
 // ---------------------------------------------------------------------------
 
-func checkStreakCondition(app *pocketbase.PocketBase, cond StreakCondition, pooProfileId string) (bool, error) {
+func checkStreakCondition(sc *scanContext, cond StreakCondition) (*Progress, error) {
 	table := cond.Table
 	if table == "" {
 		table = "poop_seshes"
 	}
+	dateField := cond.DateField
+	if dateField == "" {
+		dateField = "started"
+	}
 
-	records, err := app.FindRecordsByFilter(
-		table,
-		fmt.Sprintf("poo_profile = '%s'", pooProfileId),
-		cond.DateField,
-		10000,
-		0,
-	)
+	window, err := sc.dateRange(cond.Window)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	times, err := sc.localTimes(table, dateField, window)
+	if err != nil {
+		return nil, err
 	}
 
 	periodMap := make(map[string]int)
-	for _, record := range records {
-		t, ok := parseTime(record.GetString(cond.DateField))
-		if !ok {
-			continue
-		}
+	for _, t := range times {
 		periodMap[getPeriodKey(t, cond.StreakType)]++
 	}
 
-	return calculateLongestStreak(periodMap, cond) >= cond.ConsecutiveCount, nil
+	freezes, err := sc.streakFreezes(cond.StreakType)
+	if err != nil {
+		return nil, err
+	}
+	opts := freezes.options()
+	opts.AllowedGaps, opts.GapWindow = cond.AllowedGaps, cond.GapWindow
+
+	longest, latest := streakRuns(periodMap, cond.StreakType, cond.MinEventsPerPeriod, opts)
+	if cond.Mode != StreakModeCurrent {
+		return newProgress(float64(longest.Length), float64(cond.ConsecutiveCount), "greater_than_or_equal"), nil
+	}
+
+	now, err := sc.localNow()
+	if err != nil {
+		return nil, err
+	}
+	current := 0
+	if active, _ := latest.activeAt(now, cond.StreakType, opts, freezes.Available); active {
+		current = latest.Length
+	}
+	return newProgress(float64(current), float64(cond.ConsecutiveCount), "greater_than_or_equal"), nil
 }
 
 // ---------------------------------------------------------------------------
@@ -508,6 +787,8 @@ func matchesConditionFloat(actual, target float64, operator string) bool {
 		return actual > target
 	case "equals":
 		return actual == target
+	case "not_equals":
+		return actual != target
 	case "less_than":
 		return actual < target
 	case "less_than_or_equal":
@@ -595,46 +876,6 @@ func getPeriodKey(t time.Time, streakType string) string {
 	}
 }
 
-func calculateLongestStreak(periodMap map[string]int, cond StreakCondition) int {
-	if len(periodMap) == 0 {
-		return 0
-	}
-
-	var periods []time.Time
-	for periodStr := range periodMap {
-		periods = append(periods, parsePeriod(periodStr, cond.StreakType))
-	}
-	sort.Slice(periods, func(i, j int) bool {
-		return periods[i].Before(periods[j])
-	})
-
-	longestStreak := 0
-	currentStreak := 0
-	var prevPeriod time.Time
-
-	for i, period := range periods {
-		count := periodMap[getPeriodKey(period, cond.StreakType)]
-		if count < cond.MinEventsPerPeriod {
-			currentStreak = 0
-			prevPeriod = period
-			continue
-		}
-		if i == 0 {
-			currentStreak = 1
-		} else if isConsecutivePeriod(prevPeriod, period, cond.StreakType) {
-			currentStreak++
-		} else {
-			currentStreak = 1
-		}
-		if currentStreak > longestStreak {
-			longestStreak = currentStreak
-		}
-		prevPeriod = period
-	}
-
-	return longestStreak
-}
-
 func parsePeriod(periodStr string, streakType string) time.Time {
 	switch streakType {
 	case "daily":
@@ -643,9 +884,10 @@ func parsePeriod(periodStr string, streakType string) time.Time {
 	case "weekly":
 		var year, week int
 		fmt.Sscanf(periodStr, "%d-W%d", &year, &week)
-		jan1 := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
-		_, jan1Week := jan1.ISOWeek()
-		return jan1.AddDate(0, 0, (week-jan1Week)*7)
+		// January 4th is always in ISO week 1; step back to its Monday.
+		jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC)
+		week1 := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+		return week1.AddDate(0, 0, (week-1)*7)
 	case "monthly":
 		t, _ := time.Parse("2006-01", periodStr)
 		return t
@@ -659,7 +901,14 @@ func parsePeriod(periodStr string, streakType string) time.Time {
 // Geo proximity condition
 // ---------------------------------------------------------------------------
 
-func checkGeoProximityCondition(app *pocketbase.PocketBase, cond GeoProximityCondition, pooProfileId string) (bool, error) {
+const (
+	// defaultGeoRadiusMeters is the ocean proximity radius: one mile.
+	defaultGeoRadiusMeters = 1609
+	// maxGeoRadiusMeters keeps "near" meaningful.
+	maxGeoRadiusMeters = 50_000
+)
+
+func checkGeoProximityCondition(sc *scanContext, cond GeoProximityCondition) (*Progress, error) {
 	table := cond.Table
 	if table == "" {
 		table = "poop_seshes"
@@ -672,31 +921,31 @@ func checkGeoProximityCondition(app *pocketbase.PocketBase, cond GeoProximityCon
 	if minCount == 0 {
 		minCount = 1
 	}
-
-	mapboxToken := os.Getenv("MAPBOX_ACCESS_TOKEN")
-	if mapboxToken == "" {
-		return false, fmt.Errorf("MAPBOX_ACCESS_TOKEN environment variable not set")
+	radius := cond.RadiusMeters
+	if radius == 0 {
+		radius = defaultGeoRadiusMeters
 	}
 
-	records, err := app.FindRecordsByFilter(
-		table,
-		fmt.Sprintf("poo_profile = '%s'", pooProfileId),
-		"",
-		10000,
-		0,
-	)
+	window, err := sc.dateRange(cond.Window)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	records, err := sc.records(table)
+	if err != nil {
+		return nil, err
 	}
 
-	httpClient := &http.Client{Timeout: 10 * time.Second}
+	provider := geoFeatures()
 	count := 0
 	for _, record := range records {
+		if !window.contains(record.GetDateTime(window.Field).Time()) {
+			continue
+		}
 		ll, ok := extractLatLon(record, locationField)
 		if !ok {
 			continue
 		}
-		near, err := isNearOcean(httpClient, ll.Lon, ll.Lat, mapboxToken)
+		near, err := provider.NearOcean(ll.Lat, ll.Lon, float64(radius))
 		if err != nil {
 			log.Printf("ocean proximity check failed for sesh %s: %v", record.Id, err)
 			continue
@@ -704,12 +953,12 @@ func checkGeoProximityCondition(app *pocketbase.PocketBase, cond GeoProximityCon
 		if near {
 			count++
 			if count >= minCount {
-				return true, nil
+				break
 			}
 		}
 	}
 
-	return false, nil
+	return newProgress(float64(count), float64(minCount), "greater_than_or_equal"), nil
 }
 
 type latLon struct {
@@ -735,62 +984,3 @@ func extractLatLon(record *core.Record, field string) (latLon, bool) {
 	}
 	return ll, true
 }
-
-// isNearOcean calls the Mapbox bathymetry tile query API and returns true when
-// at least one depth feature is found within the query radius (~1 mile).
-// lon is longitude and must come before lat in the Mapbox URL.
-func isNearOcean(client *http.Client, lon, lat float64, token string) (bool, error) {
-	url := fmt.Sprintf(
-		"https://api.mapbox.com/v4/mapbox.mapbox-bathymetry-v2/tilequery/%f,%f.json?radius=1609&limit=1&dedupe&layers=depth&access_token=%s",
-		lon, lat, token,
-	)
-	resp, err := client.Get(url)
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("mapbox API status %d: %s", resp.StatusCode, body)
-	}
-
-	var result struct {
-		Features []json.RawMessage `json:"features"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false, err
-	}
-
-	return len(result.Features) > 0, nil
-}
-
-func isConsecutivePeriod(prev, current time.Time, streakType string) bool {
-	switch streakType {
-	case "daily":
-		return int(current.Sub(prev).Hours()/24) == 1
-	case "weekly":
-		prevYear, prevWeek := prev.ISOWeek()
-		currYear, currWeek := current.ISOWeek()
-		if prevYear == currYear {
-			return currWeek == prevWeek+1
-		}
-		if currYear == prevYear+1 {
-			_, lastWeek := time.Date(prevYear, 12, 31, 0, 0, 0, 0, time.UTC).ISOWeek()
-			return prevWeek == lastWeek && currWeek == 1
-		}
-		return false
-	case "monthly":
-		prevYear, prevMonth := prev.Year(), prev.Month()
-		currYear, currMonth := current.Year(), current.Month()
-		if prevYear == currYear {
-			return int(currMonth) == int(prevMonth)+1
-		}
-		if currYear == prevYear+1 {
-			return prevMonth == time.December && currMonth == time.January
-		}
-		return false
-	default:
-		return false
-	}
-}
@@ -0,0 +1,463 @@
+package achievements
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Streak modes of a StreakCondition.
+const (
+	StreakModeLongest = "longest" // the longest run ever (default)
+	StreakModeCurrent = "current" // the run that is still active now
+)
+
+// streakPeriods are the period types tracked per profile.
+var streakPeriods = []string{"daily", "weekly", "monthly"}
+
+// freezePeriod is the only period type streak freezes are spent on.
+const freezePeriod = "daily"
+
+// periodOrdinal numbers periods so that consecutive periods differ by one.
+func periodOrdinal(key, streakType string) int {
+	t := parsePeriod(key, streakType)
+	days := int(t.Unix() / 86400)
+	switch streakType {
+	case "weekly":
+		// parsePeriod returns Mondays; 1970-01-01 was a Thursday.
+		return (days + 3) / 7
+	case "monthly":
+		return t.Year()*12 + int(t.Month()) - 1
+	default:
+		return days
+	}
+}
+
+// periodKeyFromOrdinal is the inverse of periodOrdinal.
+func periodKeyFromOrdinal(ordinal int, streakType string) string {
+	switch streakType {
+	case "weekly":
+		return getPeriodKey(time.Unix(int64(ordinal*7-3)*86400, 0).UTC(), streakType)
+	case "monthly":
+		return getPeriodKey(time.Date(ordinal/12, time.Month(ordinal%12+1), 1, 0, 0, 0, 0, time.UTC), streakType)
+	default:
+		return getPeriodKey(time.Unix(int64(ordinal)*86400, 0).UTC(), streakType)
+	}
+}
+
+// streakOptions relax what counts as consecutive periods.
+type streakOptions struct {
+	// Bridged holds the ordinals of missed periods covered by a streak
+	// freeze; they keep a run going without adding to its length.
+	Bridged map[int]bool
+	// AllowedGaps missed periods are tolerated within any GapWindow
+	// consecutive periods (anywhere in the run when GapWindow is 0).
+	AllowedGaps int
+	GapWindow   int
+}
+
+// gapsAllowed reports whether the run, which already tolerated existing
+// gaps, may also skip the added ones.
+func (o streakOptions) gapsAllowed(existing, added []int) bool {
+	if len(added) == 0 {
+		return true
+	}
+	if o.AllowedGaps <= 0 {
+		return false
+	}
+
+	all := append(append([]int{}, existing...), added...)
+	if o.GapWindow <= 0 {
+		return len(all) <= o.AllowedGaps
+	}
+	for _, gap := range added {
+		for start := gap - o.GapWindow + 1; start <= gap; start++ {
+			n := 0
+			for _, g := range all {
+				if g >= start && g < start+o.GapWindow {
+					n++
+				}
+			}
+			if n > o.AllowedGaps {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// unbridged returns the ordinals strictly between from and to that no
+// streak freeze covers.
+func (o streakOptions) unbridged(from, to int) []int {
+	var missed []int
+	for ordinal := from + 1; ordinal < to; ordinal++ {
+		if !o.Bridged[ordinal] {
+			missed = append(missed, ordinal)
+		}
+	}
+	return missed
+}
+
+// streakRun is a run of consecutive qualifying periods, identified by the
+// period keys (see getPeriodKey) of its first and last period.
+type streakRun struct {
+	Length int
+	Start  string
+	End    string
+
+	end  int   // ordinal of End
+	gaps []int // ordinals of the missed periods the run tolerated
+}
+
+// streakRuns walks the periods with at least minEvents events in order and
+// returns the longest run and the run ending at the latest such period.
+func streakRuns(periodMap map[string]int, streakType string, minEvents int, opts streakOptions) (longest, latest streakRun) {
+	var ordinals []int
+	for key, count := range periodMap {
+		if count >= minEvents {
+			ordinals = append(ordinals, periodOrdinal(key, streakType))
+		}
+	}
+	sort.Ints(ordinals)
+
+	for i, ordinal := range ordinals {
+		key := periodKeyFromOrdinal(ordinal, streakType)
+		if i > 0 {
+			missed := opts.unbridged(latest.end, ordinal)
+			if opts.gapsAllowed(latest.gaps, missed) {
+				latest.Length++
+				latest.End, latest.end = key, ordinal
+				latest.gaps = append(latest.gaps, missed...)
+				if latest.Length > longest.Length {
+					longest = latest
+				}
+				continue
+			}
+		}
+		latest = streakRun{Length: 1, Start: key, End: key, end: ordinal}
+		if latest.Length > longest.Length {
+			longest = latest
+		}
+	}
+	return longest, latest
+}
+
+// activeAt reports whether the run can still be extended at now. It is at
+// risk when nothing qualified in the current period yet and the run only
+// survives if the current period counts; periods missed since the run ended
+// must be tolerated gaps or be coverable by the available freezes.
+func (r streakRun) activeAt(now time.Time, streakType string, opts streakOptions, freezes int) (active, atRisk bool) {
+	if r.Length == 0 {
+		return false, false
+	}
+	nowOrdinal := periodOrdinal(getPeriodKey(now, streakType), streakType)
+	if r.end >= nowOrdinal {
+		return true, false
+	}
+
+	missed := opts.unbridged(r.end, nowOrdinal)
+	if len(missed) <= freezes || opts.gapsAllowed(r.gaps, missed) {
+		return true, true
+	}
+	return false, false
+}
+
+// streakFreezes is a profile's streak freeze state for one period type.
+type streakFreezes struct {
+	Available int          // freezes left in the inventory
+	Bridged   map[int]bool // ordinals of periods already bridged
+}
+
+// options returns the streakOptions for the bridged periods.
+func (f streakFreezes) options() streakOptions {
+	return streakOptions{Bridged: f.Bridged}
+}
+
+// loadStreakFreezes reads the profile's freeze inventory and the periods it
+// bridged. Freezes are only spent on freezePeriod streaks.
+func loadStreakFreezes(app core.App, profile *core.Record, streakType string) (streakFreezes, error) {
+	freezes := streakFreezes{Bridged: map[int]bool{}}
+	if streakType != freezePeriod {
+		return freezes, nil
+	}
+
+	uses, err := app.FindAllRecords("streak_freeze_uses", dbx.HashExp{"poo_profile": profile.Id, "period": streakType})
+	if err != nil {
+		return freezes, err
+	}
+	for _, use := range uses {
+		freezes.Bridged[periodOrdinal(use.GetString("period_key"), streakType)] = true
+	}
+	freezes.Available = profile.GetInt("streak_freezes")
+	return freezes, nil
+}
+
+// Streak is a profile's streak for one period type.
+type Streak struct {
+	Period     string `json:"period"`     // daily, weekly or monthly
+	Current    int    `json:"current"`    // length of the active run, 0 when broken
+	Best       int    `json:"best"`       // longest run ever
+	LastPeriod string `json:"lastPeriod"` // latest period with a sesh
+	Active     bool   `json:"active"`
+	AtRisk     bool   `json:"atRisk"` // active, but nothing logged in the current period yet
+}
+
+// StreakSummary is a profile's streaks and streak freeze inventory.
+type StreakSummary struct {
+	Freezes int      `json:"freezes"` // freezes available to bridge missed days
+	Streaks []Streak `json:"streaks"`
+}
+
+// StreakService keeps the current and best streaks of each profile in the
+// streaks collection and spends the profile's streak freezes on missed days.
+type StreakService struct {
+	app *pocketbase.PocketBase
+}
+
+func NewStreakService(app *pocketbase.PocketBase) *StreakService {
+	return &StreakService{app: app}
+}
+
+// ProfileStreaks returns the profile's daily, weekly and monthly streaks as of
+// now. Streaks that were never stored are computed first.
+func (s *StreakService) ProfileStreaks(poopProfileId string) (*StreakSummary, error) {
+	records, err := s.app.FindAllRecords("streaks", dbx.HashExp{"poo_profile": poopProfileId})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < len(streakPeriods) {
+		if err := s.Recompute(poopProfileId); err != nil {
+			return nil, err
+		}
+		records, err = s.app.FindAllRecords("streaks", dbx.HashExp{"poo_profile": poopProfileId})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	profile, err := s.app.FindRecordById("poo_profiles", poopProfileId)
+	if err != nil {
+		return nil, err
+	}
+	now := localTime(time.Now(), "", loadZone(profile.GetString("timezone")))
+
+	byPeriod := make(map[string]*core.Record, len(records))
+	for _, r := range records {
+		byPeriod[r.GetString("period")] = r
+	}
+
+	summary := &StreakSummary{
+		Freezes: profile.GetInt("streak_freezes"),
+		Streaks: make([]Streak, 0, len(streakPeriods)),
+	}
+	for _, period := range streakPeriods {
+		record, ok := byPeriod[period]
+		if !ok {
+			continue
+		}
+		freezes, err := loadStreakFreezes(s.app, profile, period)
+		if err != nil {
+			return nil, err
+		}
+
+		streak := Streak{
+			Period:     period,
+			Best:       record.GetInt("best"),
+			LastPeriod: record.GetString("last_period"),
+		}
+		if streak.LastPeriod != "" {
+			run := streakRun{
+				Length: record.GetInt("current"),
+				End:    streak.LastPeriod,
+				end:    periodOrdinal(streak.LastPeriod, period),
+			}
+			streak.Active, streak.AtRisk = run.activeAt(now, period, freezes.options(), freezes.Available)
+			if streak.Active {
+				streak.Current = run.Length
+			}
+		}
+		summary.Streaks = append(summary.Streaks, streak)
+	}
+	return summary, nil
+}
+
+// Recompute rebuilds all of the profile's streaks from its seshes and the
+// periods already bridged by freezes.
+func (s *StreakService) Recompute(poopProfileId string) error {
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		return recomputeStreaks(txApp, poopProfileId)
+	})
+}
+
+// AwardFreezes adds streak freezes to the profile's inventory.
+func (s *StreakService) AwardFreezes(poopProfileId string, count int) error {
+	return awardStreakFreezes(s.app, poopProfileId, count)
+}
+
+// RecordSesh extends the streaks of the sesh's profile with a newly created
+// sesh. Missed days since the last sesh are bridged with streak freezes when
+// the profile has enough of them. Seshes older than a streak's latest period
+// (e.g. synced late) trigger a full recompute.
+func (s *StreakService) RecordSesh(sesh *core.Record) error {
+	poopProfileId := sesh.GetString("poo_profile")
+	started := sesh.GetDateTime("started")
+	if poopProfileId == "" || started.IsZero() {
+		return nil
+	}
+
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		profile, err := txApp.FindRecordById("poo_profiles", poopProfileId)
+		if err != nil {
+			return err
+		}
+		local := localTime(started.Time(), sesh.GetString("timezone"), loadZone(profile.GetString("timezone")))
+
+		records, err := txApp.FindAllRecords("streaks", dbx.HashExp{"poo_profile": poopProfileId})
+		if err != nil {
+			return err
+		}
+		byPeriod := make(map[string]*core.Record, len(records))
+		for _, r := range records {
+			byPeriod[r.GetString("period")] = r
+		}
+
+		for _, period := range streakPeriods {
+			record, ok := byPeriod[period]
+			if !ok {
+				return recomputeStreaks(txApp, poopProfileId)
+			}
+
+			key := getPeriodKey(local, period)
+			last := record.GetString("last_period")
+			if last == "" {
+				record.Set("current", 1)
+			} else {
+				ordinal, lastOrdinal := periodOrdinal(key, period), periodOrdinal(last, period)
+				if ordinal == lastOrdinal {
+					continue
+				}
+				if ordinal < lastOrdinal {
+					return recomputeStreaks(txApp, poopProfileId)
+				}
+
+				freezes, err := loadStreakFreezes(txApp, profile, period)
+				if err != nil {
+					return err
+				}
+				missed := freezes.options().unbridged(lastOrdinal, ordinal)
+				if len(missed) > 0 && len(missed) <= freezes.Available {
+					if err := spendStreakFreezes(txApp, profile, period, missed); err != nil {
+						return err
+					}
+					missed = nil
+				}
+				if len(missed) == 0 {
+					record.Set("current", record.GetInt("current")+1)
+				} else {
+					record.Set("current", 1)
+				}
+			}
+
+			record.Set("last_period", key)
+			if record.GetInt("current") > record.GetInt("best") {
+				record.Set("best", record.GetInt("current"))
+			}
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// spendStreakFreezes records one freeze use per missed period and takes
+// them from the profile's inventory.
+func spendStreakFreezes(app core.App, profile *core.Record, period string, missed []int) error {
+	collection, err := app.FindCachedCollectionByNameOrId("streak_freeze_uses")
+	if err != nil {
+		return err
+	}
+	for _, ordinal := range missed {
+		use := core.NewRecord(collection)
+		use.Set("poo_profile", profile.Id)
+		use.Set("period", period)
+		use.Set("period_key", periodKeyFromOrdinal(ordinal, period))
+		if err := app.Save(use); err != nil {
+			return err
+		}
+	}
+
+	profile.Set("streak_freezes", profile.GetInt("streak_freezes")-len(missed))
+	return app.Save(profile)
+}
+
+// awardStreakFreezes adds count freezes to the profile's inventory.
+func awardStreakFreezes(app core.App, poopProfileId string, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	return app.RunInTransaction(func(txApp core.App) error {
+		profile, err := txApp.FindRecordById("poo_profiles", poopProfileId)
+		if err != nil {
+			return err
+		}
+		profile.Set("streak_freezes", profile.GetInt("streak_freezes")+count)
+		return txApp.Save(profile)
+	})
+}
+
+// recomputeStreaks stores the streaks computed from all of the profile's
+// seshes, creating the streak records when missing.
+func recomputeStreaks(app core.App, poopProfileId string) error {
+	profile, err := app.FindRecordById("poo_profiles", poopProfileId)
+	if err != nil {
+		return err
+	}
+	times, err := queryLocalTimes(app, "poop_seshes", "started", poopProfileId, loadZone(profile.GetString("timezone")), dateRange{})
+	if err != nil {
+		return err
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId("streaks")
+	if err != nil {
+		return err
+	}
+
+	for _, period := range streakPeriods {
+		periodMap := make(map[string]int)
+		for _, t := range times {
+			periodMap[getPeriodKey(t, period)]++
+		}
+		freezes, err := loadStreakFreezes(app, profile, period)
+		if err != nil {
+			return err
+		}
+		longest, latest := streakRuns(periodMap, period, 1, freezes.options())
+
+		record, err := app.FindFirstRecordByFilter(collection,
+			"poo_profile = {:profileId} && period = {:period}",
+			dbx.Params{"profileId": poopProfileId, "period": period})
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			record = core.NewRecord(collection)
+			record.Set("poo_profile", poopProfileId)
+			record.Set("period", period)
+		}
+
+		record.Set("current", latest.Length)
+		record.Set("best", longest.Length)
+		record.Set("last_period", latest.End)
+		if err := app.Save(record); err != nil {
+			return fmt.Errorf("saving %s streak: %w", period, err)
+		}
+	}
+	return nil
+}
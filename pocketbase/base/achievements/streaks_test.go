@@ -0,0 +1,286 @@
+package achievements
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type storedStreak struct {
+	Current, Best int
+	LastPeriod    string
+}
+
+// storedStreaks returns the profile's streak records by period.
+func storedStreaks(t *testing.T, app core.App, profileId string) map[string]storedStreak {
+	t.Helper()
+	records, err := app.FindAllRecords("streaks", dbx.HashExp{"poo_profile": profileId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streaks := make(map[string]storedStreak, len(records))
+	for _, r := range records {
+		streaks[r.GetString("period")] = storedStreak{r.GetInt("current"), r.GetInt("best"), r.GetString("last_period")}
+	}
+	return streaks
+}
+
+func TestRecordSeshMatchesRecompute(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "streaker", map[string]any{"timezone": "Europe/Berlin"})
+	service := NewStreakService(app)
+
+	day := func(d, hour int) sesh {
+		return sesh{started: time.Date(2026, 6, 1+d, hour, 0, 0, 0, time.UTC)}
+	}
+	// Recorded in this order: a run, a second sesh on the same day, a gap,
+	// a late Berlin evening that is the next local day, a week later and
+	// finally a sesh synced late into the gap.
+	seshes := []sesh{day(0, 8), day(1, 8), day(1, 20), day(2, 8), day(4, 8), day(4, 22), day(12, 8), day(3, 8)}
+
+	for i, s := range seshes {
+		record := addSeshes(t, app, profile, s)[0]
+		if err := service.RecordSesh(record); err != nil {
+			t.Fatal(err)
+		}
+		incremental := storedStreaks(t, app, profile.Id)
+
+		if err := service.Recompute(profile.Id); err != nil {
+			t.Fatal(err)
+		}
+		recomputed := storedStreaks(t, app, profile.Id)
+		for _, period := range streakPeriods {
+			if incremental[period] != recomputed[period] {
+				t.Errorf("after sesh %d, %s: recorded %+v, recomputed %+v", i, period, incremental[period], recomputed[period])
+			}
+		}
+	}
+
+	// 06-01 to 06-06 (the 22:00 UTC sesh is just after midnight in Berlin),
+	// then 06-13.
+	if got := storedStreaks(t, app, profile.Id)["daily"]; got != (storedStreak{1, 6, "2026-06-13"}) {
+		t.Errorf("daily streak %+v, want best 6 and a new run on 06-13", got)
+	}
+}
+
+func TestRecomputeAfterEditAndDelete(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "editor", nil)
+	service := NewStreakService(app)
+	records := addSeshes(t, app, profile, daily(time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC), 5)...)
+	if err := service.Recompute(profile.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving the middle sesh a week on splits the run into two of two.
+	records[2].Set("started", time.Date(2026, 6, 10, 8, 0, 0, 0, time.UTC))
+	if err := app.Save(records[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Recompute(profile.Id); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedStreaks(t, app, profile.Id)["daily"]; got != (storedStreak{1, 2, "2026-06-10"}) {
+		t.Errorf("after the edit: %+v, want best 2, current 1 on 06-10", got)
+	}
+
+	if err := app.Delete(records[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Recompute(profile.Id); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedStreaks(t, app, profile.Id)["daily"]; got != (storedStreak{2, 2, "2026-06-05"}) {
+		t.Errorf("after the delete: %+v, want best and current 2 ending 06-05", got)
+	}
+}
+
+func TestStreakRunsGaps(t *testing.T) {
+	tests := []struct {
+		name string
+		days []int // days of June 2026 with a sesh
+		opts streakOptions
+		want int
+	}{
+		{"consecutive", []int{1, 2, 3, 4, 5}, streakOptions{}, 5},
+		{"gap breaks the run", []int{1, 2, 4, 5, 6}, streakOptions{}, 3},
+		{"gap tolerated", []int{1, 2, 4, 5, 6}, streakOptions{AllowedGaps: 1}, 5},
+		{"two gaps, one tolerated", []int{1, 2, 4, 5, 7}, streakOptions{AllowedGaps: 1}, 4},
+		{"one gap per window", []int{1, 2, 4, 5, 6, 7, 8, 9, 11}, streakOptions{AllowedGaps: 1, GapWindow: 7}, 9},
+		{"two gaps in one window", []int{1, 2, 4, 6, 7}, streakOptions{AllowedGaps: 1, GapWindow: 7}, 3},
+		{"bridged by a freeze", []int{1, 2, 4, 5}, streakOptions{Bridged: map[int]bool{periodOrdinal("2026-06-03", "daily"): true}}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periodMap := make(map[string]int)
+			for _, d := range tt.days {
+				periodMap[getPeriodKey(time.Date(2026, 6, d, 12, 0, 0, 0, time.UTC), "daily")]++
+			}
+			longest, _ := streakRuns(periodMap, "daily", 1, tt.opts)
+			if longest.Length != tt.want {
+				t.Errorf("longest run %d, want %d", longest.Length, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentStreakCondition(t *testing.T) {
+	app := apptest.NewApp(t)
+	today := time.Now().UTC().Truncate(24 * time.Hour).Add(12 * time.Hour)
+
+	// ago returns n daily seshes, the last one days ago.
+	ago := func(days, n int) []sesh {
+		return daily(today.AddDate(0, 0, -days-n+1), n)
+	}
+	active := apptest.NewProfile(t, app, "active", nil)
+	addSeshes(t, app, active, ago(1, 3)...)
+	lapsed := apptest.NewProfile(t, app, "lapsed", nil)
+	addSeshes(t, app, lapsed, ago(3, 3)...)
+
+	tests := []struct {
+		name    string
+		profile *core.Record
+		cond    StreakCondition
+		want    float64
+	}{
+		// Nothing logged today yet, but the run is still alive.
+		{"at risk", active, StreakCondition{StreakType: "daily", Mode: StreakModeCurrent, ConsecutiveCount: 3}, 3},
+		{"broken", lapsed, StreakCondition{StreakType: "daily", Mode: StreakModeCurrent, ConsecutiveCount: 3}, 0},
+		{"longest survives", lapsed, StreakCondition{StreakType: "daily", ConsecutiveCount: 3}, 3},
+		{"missed days tolerated", lapsed, StreakCondition{StreakType: "daily", Mode: StreakModeCurrent, ConsecutiveCount: 3, AllowedGaps: 2}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, err := checkStreakCondition(newScanContext(app, tt.profile.Id), tt.cond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress.Current != tt.want || progress.Met != (tt.want >= 3) {
+				t.Errorf("current streak %v (met %v), want %v", progress.Current, progress.Met, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreakFreezesBridgeMissedDaysOnce(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "frozen", map[string]any{"streak_freezes": 1})
+	service := NewStreakService(app)
+
+	record := func(day int) {
+		t.Helper()
+		sesh := addSeshes(t, app, profile, sesh{started: time.Date(2026, 6, day, 8, 0, 0, 0, time.UTC)})[0]
+		if err := service.RecordSesh(sesh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(current, freezes int, uses ...string) {
+		t.Helper()
+		if got := storedStreaks(t, app, profile.Id)["daily"].Current; got != current {
+			t.Errorf("daily streak %d, want %d", got, current)
+		}
+		reloaded, err := app.FindRecordById("poo_profiles", profile.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reloaded.GetInt("streak_freezes"); got != freezes {
+			t.Errorf("%d freezes left, want %d", got, freezes)
+		}
+		records, err := app.FindAllRecords("streak_freeze_uses", dbx.HashExp{"poo_profile": profile.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, r := range records {
+			keys = append(keys, r.GetString("period")+" "+r.GetString("period_key"))
+		}
+		if len(keys) != len(uses) || (len(uses) > 0 && keys[0] != uses[0]) {
+			t.Errorf("freeze uses %v, want %v", keys, uses)
+		}
+	}
+
+	record(1)
+	record(2)
+	record(4) // 06-03 missed, bridged by the only freeze
+	check(3, 0, "daily 2026-06-03")
+
+	// Another sesh that day, and a recompute, spend nothing more and keep
+	// the bridge.
+	record(4)
+	if err := service.Recompute(profile.Id); err != nil {
+		t.Fatal(err)
+	}
+	check(3, 0, "daily 2026-06-03")
+
+	// Out of freezes: the next missed day breaks the run.
+	record(6)
+	check(1, 0, "daily 2026-06-03")
+}
+
+func TestStreakFreezesOnlyBridgeDailyStreaks(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "weekly", map[string]any{"streak_freezes": 1})
+	service := NewStreakService(app)
+
+	// A week missed in between, and 13 days: more than the one freeze.
+	for _, started := range []time.Time{
+		time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 6, 15, 8, 0, 0, 0, time.UTC),
+	} {
+		if err := service.RecordSesh(addSeshes(t, app, profile, sesh{started: started})[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := storedStreaks(t, app, profile.Id)["weekly"].Current; got != 1 {
+		t.Errorf("weekly streak %d, want the missed week to break it", got)
+	}
+	if uses, _ := app.CountRecords("streak_freeze_uses"); uses != 0 {
+		t.Errorf("%d freezes spent, want none", uses)
+	}
+}
+
+func TestStreakFreezeRewardIsGrantedWithTheAchievement(t *testing.T) {
+	app := apptest.NewApp(t)
+	profile := apptest.NewProfile(t, app, "rewarded", nil)
+	addSeshes(t, app, profile, sesh{started: time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)})
+	criteria := `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}`
+	rewarding := newAchievement(t, app, "Rewarding", criteria, map[string]any{"streak_freeze_reward": 2})
+	failing := newAchievement(t, app, "Failing", criteria, map[string]any{"streak_freeze_reward": 1})
+	service := NewAchievementService(app)
+
+	freezes := func() int {
+		t.Helper()
+		reloaded, err := app.FindRecordById("poo_profiles", profile.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reloaded.GetInt("streak_freezes")
+	}
+
+	if err := service.GrantAchievement(profile.Id, rewarding.Id); err != nil {
+		t.Fatal(err)
+	}
+	if got := freezes(); got != 2 {
+		t.Errorf("%d freezes after the grant, want 2", got)
+	}
+
+	// When the reward cannot be stored, the grant is rolled back with it.
+	app.OnRecordUpdate("poo_profiles").BindFunc(func(e *core.RecordEvent) error {
+		return errors.New("profile is read-only")
+	})
+	if err := service.GrantAchievement(profile.Id, failing.Id); err == nil {
+		t.Error("want the grant to fail with its reward")
+	}
+	if has, _ := service.UserHasAchievement(profile.Id, failing.Id); has {
+		t.Error("the grant was stored without its reward")
+	}
+	if got := freezes(); got != 2 {
+		t.Errorf("%d freezes, want 2", got)
+	}
+}
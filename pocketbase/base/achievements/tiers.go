@@ -0,0 +1,241 @@
+package achievements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Tier is one level of a tiered achievement, e.g.
+//
+//	[{"name": "Bronze", "value": 10}, {"name": "Silver", "value": 50}, {"name": "Gold", "value": 100}]
+//
+// Value replaces the threshold of every condition in the achievement's
+// criteria (the target of aggregate and calculated conditions, the
+// consecutiveCount of streaks and the minCount of time-of-day, geo and
+// altitude conditions). Conditions inside a none group keep their thresholds: raising
+// them would make the achievement easier, not harder. Values must be whole
+// numbers when any replaced threshold is a count. A tier may instead
+// carry criteria of its own. Tiers are ordered: reaching a tier implies
+// reaching the ones before it.
+type Tier struct {
+	Name     string          `json:"name"`
+	Value    *float64        `json:"value,omitempty"`
+	Criteria json.RawMessage `json:"criteria,omitempty"`
+}
+
+// parseTiers decodes the achievement's tiers field. Untiered achievements
+// return no tiers.
+func parseTiers(achievement *core.Record) ([]Tier, error) {
+	return decodeTiers([]byte(achievement.GetString("tiers")))
+}
+
+// decodeTiers decodes a tiers JSON array; empty or null means no tiers.
+func decodeTiers(raw []byte) ([]Tier, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var tiers []Tier
+	if err := json.Unmarshal(raw, &tiers); err != nil {
+		return nil, fmt.Errorf("parsing tiers: %w", err)
+	}
+	return tiers, nil
+}
+
+// validateTiers checks that every tier is named, sets either a value or
+// valid criteria, and that values increase from tier to tier. Values need a
+// threshold in base to replace, and must be whole numbers when one of those
+// is an integer; base is nil when the achievement's own
+// criteria are missing or invalid.
+func validateTiers(app core.App, base *CriteriaNode, tiers []Tier) error {
+	var last *float64
+	for i, tier := range tiers {
+		if tier.Name == "" {
+			return fmt.Errorf("tiers[%d]: name: is required", i)
+		}
+		if (tier.Value == nil) == (len(tier.Criteria) == 0) {
+			return fmt.Errorf("tiers[%d]: set either value or criteria", i)
+		}
+		if tier.Value != nil {
+			if last != nil && *tier.Value <= *last {
+				return fmt.Errorf("tiers[%d]: value: must be greater than the previous tier's", i)
+			}
+			if base != nil {
+				found, integer := thresholds(base)
+				if !found {
+					return fmt.Errorf("tiers[%d]: value: the criteria have no threshold outside a none group", i)
+				}
+				if integer && *tier.Value != math.Trunc(*tier.Value) {
+					return fmt.Errorf("tiers[%d]: value: must be a whole number, the criteria count seshes, days or places", i)
+				}
+			}
+			last = tier.Value
+			continue
+		}
+		if err := ValidateCriteria(app, tier.Criteria); err != nil {
+			return fmt.Errorf("tiers[%d]: criteria: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// criteriaFor returns the criteria of the tier derived from base.
+func (t Tier) criteriaFor(base *CriteriaNode) (*CriteriaNode, error) {
+	if len(t.Criteria) > 0 {
+		return ParseCriteria(t.Criteria)
+	}
+	if t.Value == nil {
+		return nil, errors.New("tier has neither value nor criteria")
+	}
+	return withThreshold(base, *t.Value), nil
+}
+
+// withThreshold returns a copy of node with the threshold of every leaf
+// outside a none group replaced by value.
+func withThreshold(node *CriteriaNode, value float64) *CriteriaNode {
+	if node.Group == GroupNone {
+		return node
+	}
+	clone := *node
+	if node.IsLeaf() {
+		if cond, _, ok := setThreshold(node.Condition, value); ok {
+			clone.Condition = cond
+		}
+		return &clone
+	}
+
+	clone.Children = make([]*CriteriaNode, len(node.Children))
+	for i, child := range node.Children {
+		clone.Children[i] = withThreshold(child, value)
+	}
+	return &clone
+}
+
+// thresholds reports whether withThreshold changes any leaf of node, and
+// whether any of those thresholds is a whole number a tier value would be
+// truncated to.
+func thresholds(node *CriteriaNode) (found, integer bool) {
+	if node.Group == GroupNone {
+		return false, false
+	}
+	if node.IsLeaf() {
+		_, integer, ok := setThreshold(node.Condition, 0)
+		return ok, integer
+	}
+	for _, child := range node.Children {
+		childFound, childInteger := thresholds(child)
+		found = found || childFound
+		integer = integer || childInteger
+	}
+	return found, integer
+}
+
+// setThreshold returns cond with its threshold replaced by value. integer
+// is true when the threshold is a whole number and value was truncated; ok
+// is false for conditions without one.
+func setThreshold(cond any, value float64) (_ any, integer, ok bool) {
+	switch cond := cond.(type) {
+	case CalculatedCondition:
+		cond.Value = int(value)
+		return cond, true, true
+	case AggregateCondition:
+		cond.Value = value
+		return cond, false, true
+	case StreakCondition:
+		cond.ConsecutiveCount = int(value)
+		return cond, true, true
+	case TimeOfDayCondition:
+		cond.MinCount = int(value)
+		return cond, true, true
+	case GeoProximityCondition:
+		cond.MinCount = int(value)
+		return cond, true, true
+	case DistinctPlacesCondition:
+		cond.MinCount = int(value)
+		return cond, true, true
+	case TravelDistanceCondition:
+		cond.MinKilometers = value
+		return cond, false, true
+	case GeoPolygonCondition:
+		cond.MinCount = int(value)
+		return cond, true, true
+	case HomeDistanceCondition:
+		cond.MinCount = int(value)
+		return cond, true, true
+	case AltitudeCondition:
+		cond.MinCount = int(value)
+		return cond, true, true
+	}
+	return cond, false, false
+}
+
+// tierName returns the name of the 1-based tier, or "" for untiered grants.
+func tierName(tiers []Tier, tier int) string {
+	if tier < 1 || tier > len(tiers) {
+		return ""
+	}
+	return tiers[tier-1].Name
+}
+
+// evaluateTiers evaluates the tiers above fromTier in order and returns the
+// highest tier reached (fromTier when none) with the progress towards the
+// next tier, or of the top tier once all are reached.
+func evaluateTiers(sc *scanContext, base *CriteriaNode, tiers []Tier, fromTier int) (*Progress, int, error) {
+	reached := fromTier
+	var progress *Progress
+	for i := min(fromTier, len(tiers)-1); i < len(tiers); i++ {
+		criteria, err := tiers[i].criteriaFor(base)
+		if err != nil {
+			return nil, 0, fmt.Errorf("tier %q: %w", tiers[i].Name, err)
+		}
+		progress, err = evaluateCriteria(sc, criteria)
+		if err != nil {
+			return nil, 0, fmt.Errorf("tier %q: %w", tiers[i].Name, err)
+		}
+		if !progress.Met {
+			break
+		}
+		reached = max(reached, i+1)
+	}
+	return progress, reached, nil
+}
+
+// ownedTierOf returns the tier stored on a user_achievement record. Grants
+// made before the achievement had tiers count as its first tier.
+func ownedTierOf(record *core.Record) int {
+	return max(record.GetInt("tier"), 1)
+}
+
+func (r *ScanResult) addGrant(grant Grant) {
+	if !grant.Upgrade {
+		r.Earned = append(r.Earned, grant.AchievementId)
+	}
+	r.Grants = append(r.Grants, grant)
+}
+
+// reachedProgress returns the evaluation of the tier reached, for the grant
+// snapshot: progress reports the next tier up when one is left, so that tier
+// is evaluated again (from the scan cache).
+func reachedProgress(sc *scanContext, achievement *core.Record, tiers []Tier, tier int, progress *Progress) *Progress {
+	if len(tiers) == 0 || tier < 1 || progress.Met {
+		return progress
+	}
+
+	base, err := ParseCriteria([]byte(achievement.GetString("criteria")))
+	if err != nil {
+		return progress
+	}
+	criteria, err := tiers[tier-1].criteriaFor(base)
+	if err != nil {
+		return progress
+	}
+	reached, err := evaluateCriteria(sc, criteria)
+	if err != nil {
+		return progress
+	}
+	return reached
+}
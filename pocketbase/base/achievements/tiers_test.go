@@ -0,0 +1,120 @@
+package achievements
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParseCriteria(t *testing.T, criteria string) *CriteriaNode {
+	t.Helper()
+	node, err := ParseCriteria([]byte(criteria))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestWithThresholdSkipsNoneGroups(t *testing.T) {
+	base := mustParseCriteria(t, `{"all": [
+		{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 10},
+		{"any": [
+			{"conditionType": "streak", "streakType": "daily", "consecutiveCount": 3},
+			{"conditionType": "simple", "field": "is_airplane", "operator": "equals", "value": true}
+		]},
+		{"none": [
+			{"conditionType": "aggregate", "aggregation": "count", "filter": "company_time = true", "operator": "greater_than_or_equal", "value": 1},
+			{"all": [{"conditionType": "time_of_day", "startHour": 0, "endHour": 4, "minCount": 2}]}
+		]}
+	]}`)
+
+	tiered := withThreshold(base, 50)
+
+	if got := tiered.Children[0].Condition.(AggregateCondition).Value; got != 50.0 {
+		t.Errorf("count threshold %v, want 50", got)
+	}
+	if got := tiered.Children[1].Children[0].Condition.(StreakCondition).ConsecutiveCount; got != 50 {
+		t.Errorf("streak threshold %v, want 50", got)
+	}
+	if got := tiered.Children[1].Children[1].Condition.(Condition).Value; got != true {
+		t.Errorf("simple condition value %v, want it untouched", got)
+	}
+	none := tiered.Children[2]
+	if got := none.Children[0].Condition.(AggregateCondition).Value; got != 1.0 {
+		t.Errorf("company time threshold under none %v, want 1", got)
+	}
+	if got := none.Children[1].Children[0].Condition.(TimeOfDayCondition).MinCount; got != 2 {
+		t.Errorf("nested time of day threshold under none %v, want 2", got)
+	}
+
+	// The base criteria are left alone.
+	if got := base.Children[0].Condition.(AggregateCondition).Value; got != 10.0 {
+		t.Errorf("base count threshold changed to %v", got)
+	}
+}
+
+func TestValidateTiersNeedsAThreshold(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	tiers := []Tier{{Name: "Bronze", Value: value(10)}, {Name: "Silver", Value: value(50)}}
+
+	tests := []struct {
+		name     string
+		criteria string
+		wantErr  string
+	}{
+		{"aggregate", `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}`, ""},
+		{"threshold beside none", `{"all": [
+			{"conditionType": "travel_distance", "minKilometers": 100},
+			{"none": [{"conditionType": "simple", "field": "company_time", "operator": "equals", "value": true}]}
+		]}`, ""},
+		{"only under none", `{"none": [{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}]}`, "no threshold outside a none group"},
+		{"only simple", `{"conditionType": "simple", "field": "is_airplane", "operator": "equals", "value": true}`, "no threshold outside a none group"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTiers(nil, mustParseCriteria(t, tt.criteria), tiers)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTiersNeedsWholeValuesForCounts(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	fractional := []Tier{{Name: "Bronze", Value: value(1.5)}, {Name: "Silver", Value: value(1.9)}}
+	whole := []Tier{{Name: "Bronze", Value: value(1)}, {Name: "Silver", Value: value(2)}}
+
+	tests := []struct {
+		name     string
+		criteria string
+		tiers    []Tier
+		wantErr  bool
+	}{
+		{"average", `{"conditionType": "aggregate", "aggregation": "avg", "field": "rating", "operator": "greater_than_or_equal", "value": 1}`, fractional, false},
+		{"kilometers", `{"conditionType": "travel_distance", "minKilometers": 100}`, fractional, false},
+		{"streak", `{"conditionType": "streak", "streakType": "daily", "consecutiveCount": 3}`, fractional, true},
+		{"streak, whole values", `{"conditionType": "streak", "streakType": "daily", "consecutiveCount": 3}`, whole, false},
+		{"place count beside an average", `{"all": [
+			{"conditionType": "aggregate", "aggregation": "avg", "field": "rating", "operator": "greater_than_or_equal", "value": 1},
+			{"conditionType": "distinct_places", "minCount": 2}
+		]}`, fractional, true},
+		{"count under none", `{"all": [
+			{"conditionType": "travel_distance", "minKilometers": 100},
+			{"none": [{"conditionType": "time_of_day", "startHour": 0, "endHour": 4, "minCount": 2}]}
+		]}`, fractional, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTiers(nil, mustParseCriteria(t, tt.criteria), tt.tiers)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "tiers[0]: value: must be a whole number") {
+				t.Errorf("error %q does not name the first tier's value", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package achievements
+
+import (
+	"sync"
+	"time"
+)
+
+// zoneCache holds loaded locations by IANA name. Names that fail to load are
+// cached as nil so they are only looked up once.
+var zoneCache sync.Map
+
+// loadZone returns the location for an IANA zone name, or nil when the name
+// is empty or unknown (the app stores "Unknown" when its zone lookup fails).
+func loadZone(name string) *time.Location {
+	if name == "" {
+		return nil
+	}
+	if cached, ok := zoneCache.Load(name); ok {
+		return cached.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = nil
+	}
+	zoneCache.Store(name, loc)
+	return loc
+}
+
+// localTime converts t to the zone a sesh was recorded in. When that zone is
+// missing or unknown it falls back to the profile's default zone, then UTC.
+func localTime(t time.Time, zone string, fallback *time.Location) time.Time {
+	if loc := loadZone(zone); loc != nil {
+		return t.In(loc)
+	}
+	if fallback != nil {
+		return t.In(fallback)
+	}
+	return t.UTC()
+}
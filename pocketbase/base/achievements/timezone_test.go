@@ -0,0 +1,133 @@
+package achievements
+
+import (
+	"testing"
+	"time"
+)
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestLocalTime(t *testing.T) {
+	newYork := loadZone("America/New_York")
+
+	tests := []struct {
+		name     string
+		at       string // UTC
+		zone     string
+		fallback *time.Location
+		want     string // local wall clock
+	}{
+		// America/New_York springs forward at 02:00 on 2026-03-08.
+		{"before spring forward", "2026-03-08T06:59:00Z", "America/New_York", nil, "2026-03-08 01:59 EST"},
+		{"after spring forward", "2026-03-08T07:00:00Z", "America/New_York", nil, "2026-03-08 03:00 EDT"},
+		// ... and falls back at 02:00 on 2026-11-01, so 01:30 happens twice.
+		{"first 01:30 of fall back", "2026-11-01T05:30:00Z", "America/New_York", nil, "2026-11-01 01:30 EDT"},
+		{"second 01:30 of fall back", "2026-11-01T06:30:00Z", "America/New_York", nil, "2026-11-01 01:30 EST"},
+		// Europe/Berlin springs forward at 01:00 UTC on 2026-03-29.
+		{"berlin before spring forward", "2026-03-29T00:59:00Z", "Europe/Berlin", nil, "2026-03-29 01:59 CET"},
+		{"berlin after spring forward", "2026-03-29T01:00:00Z", "Europe/Berlin", nil, "2026-03-29 03:00 CEST"},
+		// Australia/Sydney falls back at 03:00 local on 2026-04-05.
+		{"sydney before fall back", "2026-04-04T15:59:00Z", "Australia/Sydney", nil, "2026-04-05 02:59 AEDT"},
+		{"sydney after fall back", "2026-04-04T16:00:00Z", "Australia/Sydney", nil, "2026-04-05 02:00 AEST"},
+		// The sesh's zone wins over the profile's.
+		{"sesh zone over profile zone", "2026-07-01T23:30:00Z", "Asia/Tokyo", newYork, "2026-07-02 08:30 JST"},
+		// Missing or unusable sesh zones fall back to the profile's, then UTC.
+		{"no sesh zone", "2026-11-01T06:30:00Z", "", newYork, "2026-11-01 01:30 EST"},
+		{"unknown sesh zone", "2026-11-01T05:30:00Z", "Unknown", newYork, "2026-11-01 01:30 EDT"},
+		{"invalid sesh zone", "2026-03-08T07:00:00Z", "Mars/Olympus_Mons", newYork, "2026-03-08 03:00 EDT"},
+		{"no zone at all", "2026-03-08T07:00:00Z", "", nil, "2026-03-08 07:00 UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := localTime(utc(tt.at), tt.zone, tt.fallback).Format("2006-01-02 15:04 MST")
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreaksAcrossDST(t *testing.T) {
+	tests := []struct {
+		name   string
+		zone   string
+		streak string
+		times  []string // UTC
+		want   int
+	}{
+		{
+			// Late-evening seshes in New York fall on the next UTC day;
+			// the 23-hour spring-forward day must not break the run.
+			name:   "daily across spring forward",
+			zone:   "America/New_York",
+			streak: "daily",
+			times: []string{
+				"2026-03-07T04:30:00Z", // 03-06 23:30 EST
+				"2026-03-08T04:30:00Z", // 03-07 23:30 EST
+				"2026-03-09T03:30:00Z", // 03-08 23:30 EDT
+				"2026-03-10T03:30:00Z", // 03-09 23:30 EDT
+			},
+			want: 4,
+		},
+		{
+			// Three seshes land on the 25-hour fall-back day, the second
+			// and third in the repeated hour and after it.
+			name:   "daily across fall back",
+			zone:   "America/New_York",
+			streak: "daily",
+			times: []string{
+				"2026-10-31T12:00:00Z", // 10-31 08:00 EDT
+				"2026-11-01T04:30:00Z", // 11-01 00:30 EDT
+				"2026-11-01T06:30:00Z", // 11-01 01:30 EST
+				"2026-11-02T04:30:00Z", // 11-01 23:30 EST
+				"2026-11-02T05:30:00Z", // 11-02 00:30 EST
+			},
+			want: 3,
+		},
+		{
+			// Bucketed in UTC these are 2026-03-28 and 2026-03-30.
+			name:   "daily in Tokyo",
+			zone:   "Asia/Tokyo",
+			streak: "daily",
+			times: []string{
+				"2026-03-28T14:30:00Z", // 03-28 23:30 JST
+				"2026-03-28T15:30:00Z", // 03-29 00:30 JST
+				"2026-03-30T14:00:00Z", // 03-30 23:00 JST
+			},
+			want: 3,
+		},
+		{
+			// Late Sunday stays in its own ISO week on both sides of the
+			// change.
+			name:   "weekly across spring forward",
+			zone:   "Europe/Berlin",
+			streak: "weekly",
+			times: []string{
+				"2026-03-22T22:30:00Z", // Sun 03-22 23:30 CET, week 12
+				"2026-03-29T21:30:00Z", // Sun 03-29 23:30 CEST, week 13
+				"2026-04-05T21:30:00Z", // Sun 04-05 23:30 CEST, week 14
+			},
+			want: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periodMap := make(map[string]int)
+			for _, at := range tt.times {
+				periodMap[getPeriodKey(localTime(utc(at), tt.zone, nil), tt.streak)]++
+			}
+			longest, _ := streakRuns(periodMap, tt.streak, 1, streakOptions{})
+			if longest.Length != tt.want {
+				t.Errorf("longest streak %d (%v), want %d", longest.Length, periodMap, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package achievements
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func validateAchievementRequest(e *core.RecordRequestEvent) error {
+	raw := e.Record.GetString("criteria")
+	var base *CriteriaNode
+	if raw != "" && raw != "null" {
+		var err error
+		base, err = ParseCriteria([]byte(raw))
+		if err == nil {
+			err = validateCriteriaNode(e.App, base)
+		}
+		if err != nil {
+			return apis.NewBadRequestError("Invalid achievement criteria.", validation.Errors{
+				"criteria": validation.NewError("validation_invalid_criteria", err.Error()),
+			})
+		}
+	}
+
+	tiers, err := parseTiers(e.Record)
+	if err == nil {
+		err = validateTiers(e.App, base, tiers)
+	}
+	if err != nil {
+		return apis.NewBadRequestError("Invalid achievement tiers.", validation.Errors{
+			"tiers": validation.NewError("validation_invalid_tiers", err.Error()),
+		})
+	}
+
+	from := e.Record.GetDateTime("available_from")
+	until := e.Record.GetDateTime("available_until")
+	if !from.IsZero() && !until.IsZero() && !until.After(from) {
+		return apis.NewBadRequestError("Invalid achievement availability.", validation.Errors{
+			"available_until": validation.NewError("validation_invalid_availability", "Must be after available_from."),
+		})
+	}
+
+	return e.Next()
+}
+
+// ValidateCriteria parses criteria and checks every condition: operators,
+// aggregations, streak types and units must be known, numbers must be in
+// range and referenced tables and fields must exist in the schema. All
+// problems are reported, each prefixed with its position in the tree.
+func ValidateCriteria(app core.App, data []byte) error {
+	node, err := ParseCriteria(data)
+	if err != nil {
+		return err
+	}
+	return validateCriteriaNode(app, node)
+}
+
+// validateCriteriaNode checks the conditions of a parsed criteria tree.
+func validateCriteriaNode(app core.App, node *CriteriaNode) error {
+	var problems []string
+	walkLeaves(node, "", func(path string, leaf *CriteriaNode) {
+		for _, problem := range validateCondition(app, leaf.Condition) {
+			problems = append(problems, path+problem)
+		}
+	})
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// walkLeaves calls fn for every leaf of the tree with its path prefix, e.g.
+// "all[0]: any[1]: ".
+func walkLeaves(node *CriteriaNode, path string, fn func(path string, leaf *CriteriaNode)) {
+	if node.IsLeaf() {
+		fn(path, node)
+		return
+	}
+	for i, child := range node.Children {
+		walkLeaves(child, fmt.Sprintf("%s%s[%d]: ", path, node.Group, i), fn)
+	}
+}
+
+// conditionChecker collects the problems found in one condition.
+type conditionChecker struct {
+	app      core.App
+	problems []string
+}
+
+func (c *conditionChecker) addf(format string, args ...any) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// collection returns the named collection (default poop_seshes), recording a
+// problem when it does not exist.
+func (c *conditionChecker) collection(table string) *core.Collection {
+	if table == "" {
+		table = "poop_seshes"
+	}
+	collection, err := c.app.FindCachedCollectionByNameOrId(table)
+	if err != nil {
+		c.addf("table: unknown table %q", table)
+		return nil
+	}
+	return collection
+}
+
+// field records a problem when collection has no field called name. key is
+// the JSON key the name came from.
+func (c *conditionChecker) field(collection *core.Collection, key, name string) {
+	if collection == nil {
+		return
+	}
+	if name == "" {
+		c.addf("%s: is required", key)
+		return
+	}
+	if err := requireField(collection, name); err != nil {
+		c.addf("%s: %v", key, err)
+	}
+}
+
+func (c *conditionChecker) operator(op string) {
+	if _, err := operatorToSQL(op); err != nil {
+		c.addf("operator: %v", err)
+	}
+}
+
+func (c *conditionChecker) min(key string, value, min int) {
+	if value < min {
+		c.addf("%s: must be at least %d", key, min)
+	}
+}
+
+func (c *conditionChecker) kilometers(value float64) {
+	if value <= 0 || value > maxKilometers {
+		c.addf("minKilometers: must be greater than 0 and at most %d", maxKilometers)
+	}
+}
+
+func (c *conditionChecker) hour(key string, value int) {
+	if value < 0 || value > 23 {
+		c.addf("%s: must be between 0 and 23", key)
+	}
+}
+
+func (c *conditionChecker) number(key string, value any) {
+	if _, ok := value.(float64); !ok {
+		c.addf("%s: must be a number", key)
+	}
+}
+
+// window records problems with a condition's date window: bounds must parse,
+// until must follow from and the date field must exist.
+func (c *conditionChecker) window(collection *core.Collection, w *DateWindow) {
+	if w == nil {
+		return
+	}
+	if _, err := w.resolve(time.UTC); err != nil {
+		c.addf("window: %v", err)
+	}
+	c.field(collection, "window: field", defaultString(w.Field, "started"))
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCondition returns the problems found in a decoded leaf condition.
+func validateCondition(app core.App, condition any) []string {
+	c := &conditionChecker{app: app}
+
+	switch cond := condition.(type) {
+	case Condition:
+		collection := c.collection(cond.Table)
+		c.field(collection, "table", "poo_profile")
+		c.field(collection, "field", cond.Field)
+		c.operator(cond.Operator)
+		if cond.Value == nil {
+			c.addf("value: is required")
+		}
+		c.window(collection, cond.Window)
+
+	case CalculatedCondition:
+		if !oneOf(cond.Calculation, "", "duration") {
+			c.addf("calculation: unknown calculation %q", cond.Calculation)
+		}
+		if !oneOf(cond.Unit, "", "seconds", "minutes", "hours", "days") {
+			c.addf("unit: unknown unit %q", cond.Unit)
+		}
+		collection := c.collection(cond.Table)
+		c.field(collection, "startField", defaultString(cond.StartField, "started"))
+		c.field(collection, "endField", defaultString(cond.EndField, "ended"))
+		c.operator(cond.Operator)
+		c.min("value", cond.Value, 0)
+		c.window(collection, cond.Window)
+
+	case AggregateCondition:
+		if !oneOf(cond.Aggregation, "count", "count_distinct", "sum", "avg", "max_group_count") {
+			c.addf("aggregation: unknown aggregation %q", cond.Aggregation)
+		}
+		collection := c.collection(cond.Table)
+		c.field(collection, "profileField", defaultString(cond.ProfileField, "poo_profile"))
+		if cond.Aggregation != "count" {
+			c.field(collection, "field", cond.Field)
+		}
+		if collection != nil && cond.Filter != "" {
+			if _, _, err := profileQuery(app, collection.Name, "", "", cond.Filter); err != nil {
+				c.addf("filter: %v", err)
+			}
+		}
+		c.operator(cond.Operator)
+		c.number("value", cond.Value)
+		c.window(collection, cond.Window)
+
+	case StreakCondition:
+		if !oneOf(cond.StreakType, "daily", "weekly", "monthly") {
+			c.addf("streakType: must be daily, weekly or monthly")
+		}
+		collection := c.collection(cond.Table)
+		c.field(collection, "dateField", defaultString(cond.DateField, "started"))
+		c.min("consecutiveCount", cond.ConsecutiveCount, 1)
+		c.min("minEventsPerPeriod", cond.MinEventsPerPeriod, 0)
+		if !oneOf(cond.Mode, "", StreakModeLongest, StreakModeCurrent) {
+			c.addf("mode: must be longest or current")
+		}
+		c.min("allowedGaps", cond.AllowedGaps, 0)
+		c.min("gapWindow", cond.GapWindow, 0)
+		if cond.GapWindow > 0 && cond.AllowedGaps >= cond.GapWindow {
+			c.addf("allowedGaps: must be less than gapWindow")
+		}
+		c.window(collection, cond.Window)
+
+	case TimeOfDayCondition:
+		collection := c.collection(cond.Table)
+		c.field(collection, "field", defaultString(cond.Field, "started"))
+		c.hour("startHour", cond.StartHour)
+		c.hour("endHour", cond.EndHour)
+		if cond.StartHour == cond.EndHour {
+			c.addf("endHour: must differ from startHour")
+		}
+		c.min("minCount", cond.MinCount, 0)
+		c.window(collection, cond.Window)
+
+	case GeoProximityCondition:
+		collection := c.collection(cond.Table)
+		c.field(collection, "locationField", defaultString(cond.LocationField, "location"))
+		c.min("radiusMeters", cond.RadiusMeters, 0)
+		if cond.RadiusMeters > maxGeoRadiusMeters {
+			c.addf("radiusMeters: must be at most %d", maxGeoRadiusMeters)
+		}
+		c.min("minCount", cond.MinCount, 0)
+		c.window(collection, cond.Window)
+
+	case DistinctPlacesCondition:
+		collection := c.collection(cond.Table)
+		level := defaultString(cond.Level, "country")
+		if oneOf(level, placeLevels...) {
+			c.field(collection, "level", level)
+		} else {
+			c.addf("level: must be one of %s", strings.Join(placeLevels, ", "))
+		}
+		c.min("minCount", cond.MinCount, 0)
+		c.window(collection, cond.Window)
+
+	case TravelDistanceCondition:
+		collection := c.collection(cond.Table)
+		c.field(collection, "locationField", defaultString(cond.LocationField, "location"))
+		c.kilometers(cond.MinKilometers)
+		c.window(collection, cond.Window)
+
+	case GeoPolygonCondition:
+		collection := c.collection(cond.Table)
+		c.field(collection, "locationField", defaultString(cond.LocationField, "location"))
+		if len(cond.Area) == 0 {
+			c.addf("area: is required")
+		} else if polygons, err := parseGeoJSONPolygons(cond.Area); err != nil {
+			c.addf("area: %v", err)
+		} else if len(polygons) == 0 {
+			c.addf("area: must contain a Polygon or MultiPolygon")
+		}
+		c.min("minCount", cond.MinCount, 0)
+		c.window(collection, cond.Window)
+
+	case HomeDistanceCondition:
+		collection := c.collection(cond.Table)
+		c.field(collection, "locationField", defaultString(cond.LocationField, "location"))
+		c.kilometers(cond.MinKilometers)
+		c.min("minCount", cond.MinCount, 0)
+		c.window(collection, cond.Window)
+
+	case AltitudeCondition:
+		collection := c.collection(cond.Table)
+		c.field(collection, "field", defaultString(cond.Field, "altitude"))
+		switch {
+		case cond.MinMeters == nil && cond.MaxMeters == nil:
+			c.addf("minMeters: minMeters or maxMeters is required")
+		case cond.MinMeters != nil && cond.MaxMeters != nil && *cond.MinMeters >= *cond.MaxMeters:
+			c.addf("maxMeters: must be greater than minMeters")
+		}
+		c.min("minCount", cond.MinCount, 0)
+		c.window(collection, cond.Window)
+
+	default:
+		c.addf("unsupported condition %T", condition)
+	}
+
+	return c.problems
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
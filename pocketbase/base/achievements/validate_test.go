@@ -0,0 +1,85 @@
+package achievements
+
+import (
+	"strings"
+	"testing"
+
+	"loglog/internal/apptest"
+)
+
+func TestValidateCriteria(t *testing.T) {
+	app := apptest.NewApp(t)
+
+	tests := []struct {
+		name     string
+		criteria string
+		want     string // part of the error, empty for valid criteria
+	}{
+		{"valid", `{"conditionType": "aggregate", "aggregation": "count", "operator": "greater_than_or_equal", "value": 1}`, ""},
+		{"not_equals", `{"conditionType": "calculated", "operator": "not_equals", "value": 5, "unit": "minutes"}`, ""},
+		{"unknown operator", `{"conditionType": "aggregate", "aggregation": "count", "operator": "at_least", "value": 1}`, "operator: unknown operator: at_least"},
+		{"missing operator", `{"conditionType": "calculated", "value": 5}`, "operator: unknown operator"},
+		{"unknown aggregation", `{"conditionType": "aggregate", "aggregation": "median", "field": "rating", "operator": "equals", "value": 1}`, `aggregation: unknown aggregation "median"`},
+		{"unknown streak type", `{"conditionType": "streak", "streakType": "hourly", "consecutiveCount": 3}`, "streakType: must be daily, weekly or monthly"},
+		{"start hour out of range", `{"conditionType": "time_of_day", "startHour": -1, "endHour": 6}`, "startHour: must be between 0 and 23"},
+		{"end hour out of range", `{"conditionType": "time_of_day", "startHour": 22, "endHour": 24}`, "endHour: must be between 0 and 23"},
+		{"unknown table", `{"conditionType": "aggregate", "table": "nope", "aggregation": "count", "operator": "equals", "value": 1}`, `table: unknown table "nope"`},
+		{"unknown field", `{"conditionType": "aggregate", "aggregation": "sum", "field": "nope", "operator": "equals", "value": 1}`, "field: "},
+		{"altitude", `{"conditionType": "altitude", "minMeters": 3000, "minCount": 1}`, ""},
+		{"altitude without bounds", `{"conditionType": "altitude", "minCount": 1}`, "minMeters: minMeters or maxMeters is required"},
+		{"altitude bounds reversed", `{"conditionType": "altitude", "minMeters": 100, "maxMeters": 0}`, "maxMeters: must be greater than minMeters"},
+		{"unknown simple field", `{"conditionType": "simple", "table": "poop_seshes", "field": "nope", "operator": "equals", "value": 1}`, "field: "},
+		{
+			"every problem with its path",
+			`{"all": [
+				{"conditionType": "aggregate", "aggregation": "count", "operator": "equals", "value": 1},
+				{"any": [{"conditionType": "time_of_day", "startHour": 25, "endHour": 3}]}
+			]}`,
+			"all[1]: any[0]: startHour",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCriteria(app, []byte(tt.criteria))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("want an error containing %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Every operator the validator accepts must be one the evaluators match, or
+// criteria using it would pass validation and never be earned.
+func TestMatchesEveryValidOperator(t *testing.T) {
+	tests := []struct {
+		operator string
+		below    bool // 1 against 2
+		equal    bool // 2 against 2
+		above    bool // 3 against 2
+	}{
+		{"equals", false, true, false},
+		{"not_equals", true, false, true},
+		{"greater_than", false, false, true},
+		{"greater_than_or_equal", false, true, true},
+		{"less_than", true, false, false},
+		{"less_than_or_equal", true, true, false},
+	}
+	for _, tt := range tests {
+		if _, err := operatorToSQL(tt.operator); err != nil {
+			t.Errorf("%s: %v", tt.operator, err)
+		}
+		got := [3]bool{
+			matchesConditionFloat(1, 2, tt.operator),
+			matchesConditionFloat(2, 2, tt.operator),
+			matchesConditionFloat(3, 2, tt.operator),
+		}
+		if got != [3]bool{tt.below, tt.equal, tt.above} {
+			t.Errorf("%s: below, equal, above match %v", tt.operator, got)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package achievements
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// DateWindow restricts a condition to the records dated inside it, e.g.
+//
+//	{"from": "2026-11-19", "until": "2026-11-19"}
+//
+// for seshes logged on World Toilet Day. Bounds are RFC 3339 timestamps or
+// plain dates; a plain date covers the whole day in the profile's default
+// zone, so until is inclusive of its day. Either bound may be left open.
+type DateWindow struct {
+	From  string `json:"from"`
+	Until string `json:"until"`
+	Field string `json:"field"` // datetime field, default "started"
+}
+
+// dateRange is a DateWindow resolved to instants: records dated in
+// [From, Until) match. A zero bound is open and a zero dateRange matches
+// everything.
+type dateRange struct {
+	Field string
+	From  time.Time
+	Until time.Time
+}
+
+// resolve converts the window's bounds to instants, reading plain dates in loc.
+func (w *DateWindow) resolve(loc *time.Location) (dateRange, error) {
+	if w == nil {
+		return dateRange{}, nil
+	}
+
+	r := dateRange{Field: defaultString(w.Field, "started")}
+	var err error
+	if r.From, err = parseWindowBound(w.From, loc, false); err != nil {
+		return r, fmt.Errorf("from: %w", err)
+	}
+	if r.Until, err = parseWindowBound(w.Until, loc, true); err != nil {
+		return r, fmt.Errorf("until: %w", err)
+	}
+	if !r.From.IsZero() && !r.Until.IsZero() && !r.From.Before(r.Until) {
+		return r, errors.New("until: must be after from")
+	}
+	return r, nil
+}
+
+// parseWindowBound parses a window bound. Plain dates resolve to the start of
+// the day in loc, or to the start of the next day for an end bound.
+func parseWindowBound(s string, loc *time.Location, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	if day, err := time.ParseInLocation(time.DateOnly, s, loc); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day.UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date (YYYY-MM-DD) nor an RFC 3339 timestamp", s)
+	}
+	return t.UTC(), nil
+}
+
+func (r dateRange) isZero() bool {
+	return r.From.IsZero() && r.Until.IsZero()
+}
+
+// key identifies the range in scan cache keys.
+func (r dateRange) key() string {
+	if r.isZero() {
+		return ""
+	}
+	return fmt.Sprintf("%s|%d|%d", r.Field, r.From.Unix(), r.Until.Unix())
+}
+
+// contains reports whether t lies inside the range.
+func (r dateRange) contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.Until.IsZero() && !t.Before(r.Until) {
+		return false
+	}
+	return true
+}
+
+// apply restricts query to the collection's records dated inside the range.
+func (r dateRange) apply(query *dbx.SelectQuery, collection *core.Collection) error {
+	if r.isZero() {
+		return nil
+	}
+	if err := requireField(collection, r.Field); err != nil {
+		return err
+	}
+
+	field := "[[" + r.Field + "]]"
+	query.AndWhere(dbx.NewExp(field + " != ''"))
+	if !r.From.IsZero() {
+		query.AndWhere(dbx.NewExp(field+" >= {:windowFrom}", dbx.Params{"windowFrom": formatDateTime(r.From)}))
+	}
+	if !r.Until.IsZero() {
+		query.AndWhere(dbx.NewExp(field+" < {:windowUntil}", dbx.Params{"windowUntil": formatDateTime(r.Until)}))
+	}
+	return nil
+}
+
+// formatDateTime formats t the way PocketBase stores datetime fields, so
+// stored values compare correctly as strings.
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(types.DefaultDateLayout)
+}
+
+// dateRange resolves a condition's window in the profile's default zone.
+func (sc *scanContext) dateRange(w *DateWindow) (dateRange, error) {
+	if w == nil {
+		return dateRange{}, nil
+	}
+	profile, err := sc.profile()
+	if err != nil {
+		return dateRange{}, err
+	}
+	r, err := w.resolve(loadZone(profile.GetString("timezone")))
+	if err != nil {
+		return r, fmt.Errorf("window: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// Type names an event. Webhook subscriptions and activity entries store it.
+type Type string
+
+const (
+	SeshStarted         Type = "sesh.started"
+	SeshEnded           Type = "sesh.ended"
+	FollowRequested     Type = "follow.requested"
+	FollowApproved      Type = "follow.approved"
+	AchievementEarned   Type = "achievement.earned"
+	AchievementUpgraded Type = "achievement.upgraded"
+	AchievementRevoked  Type = "achievement.revoked"
+)
+
+// Types lists every event type.
+var Types = []Type{
+	SeshStarted, SeshEnded, FollowRequested, FollowApproved,
+	AchievementEarned, AchievementUpgraded, AchievementRevoked,
+}
+
+// Event is something that happened to a poo profile.
+type Event struct {
+	Id        string         `json:"id"`
+	Type      Type           `json:"type"`
+	ProfileId string         `json:"profileId"` // the poo profile the event is about
+	Data      map[string]any `json:"data,omitempty"`
+	Time      time.Time      `json:"time"`
+}
+
+// Handler reacts to an event. Returned errors are logged.
+type Handler func(Event) error
+
+type subscription struct {
+	name    string
+	types   []Type // empty: every type
+	handler Handler
+}
+
+// Bus delivers published events to their subscribers: the activity feed
+// and outbound webhooks. Push notifications are not one. Subscribers run
+// after the publishing write has committed, so a push queued from one could
+// be lost with the process; notifications.RegisterHooks queues pushes in
+// the transaction that makes the write instead.
+//
+// Publish never blocks: every subscriber runs in its own goroutine, so a slow
+// webhook cannot delay the activity feed or the request that published the
+// event. Events are not persisted; whatever is still running when the
+// process stops is lost once Shutdown gives up.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   []subscription
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers handler for the given event types, or for every type
+// when none are given. name identifies the subscriber in logs.
+func (b *Bus) Subscribe(name string, handler Handler, types ...Type) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, subscription{name: name, types: types, handler: handler})
+}
+
+// Publish fills in the event's id and time and hands it to every matching
+// subscriber. Events published after Shutdown are dropped.
+func (b *Bus) Publish(event Event) {
+	if event.Id == "" {
+		event.Id = security.RandomString(15)
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		log.Printf("Event bus is shut down, dropping %s event for profile %s", event.Type, event.ProfileId)
+		return
+	}
+
+	for _, sub := range b.subs {
+		if len(sub.types) > 0 && !slices.Contains(sub.types, event.Type) {
+			continue
+		}
+		b.wg.Add(1)
+		go b.deliver(sub, event)
+	}
+}
+
+func (b *Bus) deliver(sub subscription, event Event) {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event subscriber %s panicked on %s event %s: %v", sub.name, event.Type, event.Id, r)
+		}
+	}()
+
+	if err := sub.handler(event); err != nil {
+		log.Printf("Event subscriber %s failed on %s event %s: %v", sub.name, event.Type, event.Id, err)
+	}
+}
+
+// Shutdown stops accepting events and waits for the running subscribers to
+// finish, or for ctx to be done.
+func (b *Bus) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
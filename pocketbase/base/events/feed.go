@@ -0,0 +1,28 @@
+package events
+
+import (
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// feedTypes are the events shown in the activity feed.
+var feedTypes = []Type{SeshEnded, FollowApproved, AchievementEarned, AchievementUpgraded}
+
+// RegisterFeed subscribes the activity feed to the bus. Every feed event is
+// stored as an activity record, visible to the profile itself and to its
+// approved followers.
+func RegisterFeed(app *pocketbase.PocketBase, bus *Bus) {
+	bus.Subscribe("activity", func(event Event) error {
+		collection, err := app.FindCachedCollectionByNameOrId("activity")
+		if err != nil {
+			return err
+		}
+
+		record := core.NewRecord(collection)
+		record.Set("poo_profile", event.ProfileId)
+		record.Set("type", string(event.Type))
+		record.Set("event_id", event.Id)
+		record.Set("data", event.Data)
+		return app.Save(record)
+	}, feedTypes...)
+}
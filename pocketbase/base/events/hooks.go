@@ -0,0 +1,66 @@
+package events
+
+import (
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterHooks publishes the sesh and follow events from record hooks.
+// They run after the change is committed, so subscribers always see it.
+func RegisterHooks(app *pocketbase.PocketBase, bus *Bus) {
+	app.OnRecordAfterCreateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		bus.Publish(seshEvent(SeshStarted, e.Record))
+		if !e.Record.GetDateTime("ended").IsZero() {
+			bus.Publish(seshEvent(SeshEnded, e.Record))
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.Original().GetDateTime("ended").IsZero() && !e.Record.GetDateTime("ended").IsZero() {
+			bus.Publish(seshEvent(SeshEnded, e.Record))
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess("follows").BindFunc(func(e *core.RecordEvent) error {
+		switch e.Record.GetString("status") {
+		case "pending":
+			bus.Publish(followEvent(FollowRequested, e.Record))
+		case "approved":
+			bus.Publish(followEvent(FollowApproved, e.Record))
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess("follows").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("status") == "approved" && e.Record.Original().GetString("status") != "approved" {
+			bus.Publish(followEvent(FollowApproved, e.Record))
+		}
+		return e.Next()
+	})
+}
+
+func seshEvent(eventType Type, sesh *core.Record) Event {
+	data := map[string]any{
+		"seshId":  sesh.Id,
+		"started": sesh.GetDateTime("started"),
+	}
+	if ended := sesh.GetDateTime("ended"); !ended.IsZero() {
+		data["ended"] = ended
+		data["durationSeconds"] = int(ended.Time().Sub(sesh.GetDateTime("started").Time()).Seconds())
+	}
+	return Event{Type: eventType, ProfileId: sesh.GetString("poo_profile"), Data: data}
+}
+
+// followEvent is about the follower; following is the profile being followed.
+func followEvent(eventType Type, follow *core.Record) Event {
+	return Event{
+		Type:      eventType,
+		ProfileId: follow.GetString("follower"),
+		Data: map[string]any{
+			"followId":  follow.Id,
+			"following": follow.GetString("following"),
+		},
+	}
+}
@@ -0,0 +1,143 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// webhookAttempts is how often a delivery is tried before giving up.
+	webhookAttempts = 5
+	webhookTimeout  = 10 * time.Second
+)
+
+// webhookBackoff is the wait before the first retry; it doubles after every
+// failed attempt (1s, 2s, 4s, 8s). Tests shorten it.
+var webhookBackoff = time.Second
+
+// Webhook headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret, prefixed "sha256=".
+// Receivers should recompute it and reject old timestamps.
+const (
+	HeaderEventId   = "X-LogLog-Event-Id"
+	HeaderEventType = "X-LogLog-Event"
+	HeaderTimestamp = "X-LogLog-Timestamp"
+	HeaderSignature = "X-LogLog-Signature"
+)
+
+// RegisterWebhooks subscribes the outbound webhooks to every event. Each
+// active record in the webhooks collection whose events list contains the
+// event's type (or is empty) receives a signed POST of the event as JSON.
+func RegisterWebhooks(app *pocketbase.PocketBase, bus *Bus) {
+	client := &http.Client{Timeout: webhookTimeout}
+
+	bus.Subscribe("webhooks", func(event Event) error {
+		hooks, err := app.FindRecordsByFilter("webhooks", "active = true", "", 0, 0)
+		if err != nil {
+			return err
+		}
+
+		// Retries sleep, so every webhook is delivered concurrently. The
+		// subscriber waits for all of them so Bus.Shutdown does too.
+		var wg sync.WaitGroup
+		for _, hook := range hooks {
+			var types []Type
+			if err := hook.UnmarshalJSONField("events", &types); err != nil {
+				log.Printf("Webhook %s has invalid events: %v", hook.Id, err)
+				continue
+			}
+			if len(types) > 0 && !slices.Contains(types, event.Type) {
+				continue
+			}
+
+			wg.Add(1)
+			go func(hook *core.Record) {
+				defer wg.Done()
+				if err := deliverWebhook(client, hook.GetString("url"), hook.GetString("secret"), event); err != nil {
+					log.Printf("Webhook %s gave up on %s event %s: %v", hook.Id, event.Type, event.Id, err)
+				}
+			}(hook)
+		}
+		wg.Wait()
+		return nil
+	})
+}
+
+// deliverWebhook posts the event to url, retrying network errors, 429s and
+// 5xx responses with exponential backoff.
+func deliverWebhook(client *http.Client, url, secret string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := postWebhook(client, url, secret, event, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == webhookAttempts {
+			return fmt.Errorf("attempt %d: %w", attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postWebhook makes one delivery attempt and reports whether a failure is
+// worth retrying.
+func postWebhook(client *http.Client, url, secret string, event Event, body []byte) (retry bool, err error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LogLog-Webhooks/1.0")
+	req.Header.Set(HeaderEventId, event.Id)
+	req.Header.Set(HeaderEventType, string(event.Type))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a webhook body sent at
+// timestamp (unix seconds).
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
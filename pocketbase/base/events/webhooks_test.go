@@ -0,0 +1,173 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// receiver is a webhook endpoint answering with statuses in turn, then 200.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) attempts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func fastRetries(t *testing.T) {
+	backoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+	t.Cleanup(func() { webhookBackoff = backoff })
+}
+
+func TestWebhookSignature(t *testing.T) {
+	r := newReceiver(t)
+	event := Event{Id: "evt1", Type: AchievementEarned, ProfileId: "p1", Data: map[string]any{"name": "First Sesh"}, Time: time.Now().UTC()}
+
+	if err := deliverWebhook(http.DefaultClient, r.URL, "0123456789abcdef", event); err != nil {
+		t.Fatal(err)
+	}
+
+	req, body := r.requests[0], r.bodies[0]
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Errorf("timestamp %q, want the current unix time", timestamp)
+	}
+
+	mac := hmac.New(sha256.New, []byte("0123456789abcdef"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	if got, want := req.Header.Get(HeaderSignature), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature %q, want %q", got, want)
+	}
+
+	if req.Header.Get(HeaderEventId) != "evt1" || req.Header.Get(HeaderEventType) != "achievement.earned" {
+		t.Errorf("event headers %q %q", req.Header.Get(HeaderEventId), req.Header.Get(HeaderEventType))
+	}
+	var sent Event
+	if err := json.Unmarshal(body, &sent); err != nil || sent.Id != "evt1" || sent.Data["name"] != "First Sesh" {
+		t.Errorf("body %s (%v), want the event", body, err)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	fastRetries(t)
+
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		wantErr  bool
+	}{
+		{"delivered", nil, 1, false},
+		{"server errors retried", []int{500, 502, 503}, 4, false},
+		{"rate limit retried", []int{429}, 2, false},
+		{"bad request not retried", []int{400}, 1, true},
+		{"gone not retried", []int{410}, 1, true},
+		{"gives up", []int{500, 500, 500, 500, 500}, webhookAttempts, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReceiver(t, tt.statuses...)
+			err := deliverWebhook(http.DefaultClient, r.URL, "secret", Event{Id: "evt", Type: SeshStarted})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if got := r.attempts(); got != tt.attempts {
+				t.Errorf("%d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestShutdownDrainsWebhookDeliveries(t *testing.T) {
+	fastRetries(t)
+	// Long enough for the retries to still be running at Shutdown.
+	webhookBackoff = 50 * time.Millisecond
+	app := apptest.NewApp(t)
+
+	earned := newReceiver(t, 503, 503)
+	all := newReceiver(t)
+	webhooks, err := app.FindCollectionByNameOrId("webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, hook := range map[string]struct {
+		url    string
+		events string
+		active bool
+	}{
+		"earned":   {earned.URL, `["achievement.earned"]`, true},
+		"all":      {all.URL, `[]`, true},
+		"inactive": {all.URL, `[]`, false},
+	} {
+		record := core.NewRecord(webhooks)
+		record.Set("name", name)
+		record.Set("url", hook.url)
+		record.Set("secret", "0123456789abcdef")
+		record.Set("events", hook.events)
+		record.Set("active", hook.active)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bus := NewBus()
+	RegisterWebhooks(app, bus)
+	bus.Publish(Event{Type: AchievementEarned, ProfileId: "p1"})
+	bus.Publish(Event{Type: SeshStarted, ProfileId: "p1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := bus.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(Event{Type: SeshEnded, ProfileId: "p1"})
+
+	// The earned hook got its event on the third try; the catch-all one got
+	// both events once, and nothing published after Shutdown.
+	if got := earned.attempts(); got != 3 {
+		t.Errorf("earned hook: %d attempts, want 3", got)
+	}
+	if got := all.attempts(); got != 2 {
+		t.Errorf("catch-all hook: %d deliveries, want 2", got)
+	}
+}
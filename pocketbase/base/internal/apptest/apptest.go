@@ -0,0 +1,67 @@
+// Package apptest holds the fixtures shared by the database-backed tests:
+// a migrated app in a temporary data dir and users with a poo profile.
+package apptest
+
+import (
+	"testing"
+
+	_ "loglog/migrations"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// NewApp returns an app with every migration applied, in a temporary data
+// dir.
+//
+// Importing the collections snapshot migration recurses forever in
+// PocketBase's Collection.UnmarshalJSON when encoding/json is backed by
+// json/v2 (the default from Go 1.27 on), so the test is skipped there with a
+// pointer to `make test`, which builds with GOEXPERIMENT=nojsonv2.
+func NewApp(t testing.TB) *pocketbase.PocketBase {
+	t.Helper()
+	if jsonV2 {
+		t.Skip("database tests need GOEXPERIMENT=nojsonv2 on this toolchain; run `make test`")
+	}
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	return app
+}
+
+// NewProfile creates a user and a poo profile for it, with the given profile
+// fields (timezone, expo_push_token, ...) set on top of the code name.
+func NewProfile(t testing.TB, app core.App, codeName string, fields map[string]any) *core.Record {
+	t.Helper()
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := core.NewRecord(users)
+	user.SetEmail(codeName + "@example.com")
+	user.SetPassword("1234567890")
+	user.Set("codeName", codeName)
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := app.FindCollectionByNameOrId("poo_profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := core.NewRecord(profiles)
+	profile.Set("user", user.Id)
+	profile.Set("codeName", codeName)
+	for name, value := range fields {
+		profile.Set(name, value)
+	}
+	if err := app.Save(profile); err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
@@ -0,0 +1,5 @@
+//go:build !goexperiment.jsonv2
+
+package apptest
+
+const jsonV2 = false
@@ -1,18 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/mail"
 	"os"
 	"strings"
+	"time"
 
 	_ "loglog/migrations"
 	"loglog/notifications"
 	"loglog/achievements"
+	"loglog/events"
 
 	"github.com/joho/godotenv"
-	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
@@ -65,93 +67,67 @@ func main() {
 		return e.Next()
 	})
 
-	// scanAndNotifyAchievements runs an achievement scan and sends a push
-	// notification for each newly earned achievement.
-	scanAndNotifyAchievements := func(poopProfileId string) {
-		achievementService := achievements.NewAchievementService(app)
-		earned, err := achievementService.AchievementScan(poopProfileId)
-		if err != nil {
-			fmt.Println("Error scanning achievements:", err)
-			return
-		}
-		if len(earned) == 0 {
-			return
-		}
-		fmt.Printf("Profile %s earned %d achievement(s): %v\n", poopProfileId, len(earned), earned)
+	// Services publish to the event bus; the activity feed and webhooks
+	// subscribe to it.
+	bus := events.NewBus()
+	events.RegisterHooks(app, bus)
+	events.RegisterFeed(app, bus)
+	events.RegisterWebhooks(app, bus)
 
-		notificationService := notifications.NewNotificationService(app)
-		for _, achievementId := range earned {
-			achievement, err := app.FindRecordById("achievements", achievementId)
-			if err != nil {
-				fmt.Println("Error fetching achievement for notification:", err)
-				continue
-			}
-			notificationService.SendPushNotification(
-				poopProfileId,
-				notifications.Achievement,
-				notifications.NotificationData{
-					Title:  "Achievement Unlocked!",
-					Body:   "You earned: " + achievement.GetString("name"),
-					Screen: "/(protected)/(tabs)/achievements",
-				},
-				nil,
-			)
-		}
-	}
+	// Push notifications are queued with the writes that cause them and
+	// delivered by the outbox worker.
+	notifications.RegisterHooks(app)
+	outbox := notifications.RegisterOutbox(app)
 
-	app.OnRecordAfterCreateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
-		notificationService := notifications.NewNotificationService(app)
-		fmt.Println("Poop sesh created")
-		activeSesh := e.Record
+	publishAchievements := achievements.Publisher(bus)
 
-		// Scan for count/streak/time-of-day achievements on new sesh creation.
-		go scanAndNotifyAchievements(activeSesh.GetString("poo_profile"))
+	scanQueue := achievements.NewScanQueue(app, 4, publishAchievements)
 
-		// Get poo pals that follow you
-		followers, err := app.FindAllRecords("follows", dbx.NewExp("following = {:following}", dbx.Params{"following": activeSesh.GetString("poo_profile")}))
-		if err != nil {
-			return e.Next()
-		}
+	achievements.RegisterHooks(app)
+	achievements.RegisterCron(app)
+	notifications.RegisterCron(app)
 
-		if len(followers) == 0 {
-			return e.Next()
-		}
+	// `achievements rescan` backfills grants after criteria changes.
+	app.RootCmd.AddCommand(achievements.NewCommand(app, publishAchievements))
+	// `notifications replay` requeues pushes the outbox gave up on.
+	app.RootCmd.AddCommand(notifications.NewCommand(app))
 
-		followersIds := []string{}
-		for _, follower := range followers {
-			followersIds = append(followersIds, follower.GetString("follower"))
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := scanQueue.Shutdown(ctx); err != nil {
+			fmt.Println("Error draining achievement scan queue:", err)
 		}
-
-		// Get all poo seshes from the above followers. They should be started and not ended
-		var conditions []string
-		for _, id := range followersIds {
-			conditions = append(conditions, fmt.Sprintf("poo_profile ~ '%s'", id))
+		// After the queue, which publishes its results to the bus.
+		if err := bus.Shutdown(ctx); err != nil {
+			fmt.Println("Error draining event bus:", err)
 		}
-		profileFilter := strings.Join(conditions, " || ")
-		poopSeshes, err := app.FindRecordsByFilter("poop_seshes", "( "+profileFilter+" ) && started != null && ended = null", "-started", 100, 0)
-		if err != nil {
-			fmt.Println("Error getting poo seshes", err)
-			return e.Next()
+		if err := outbox.Shutdown(ctx); err != nil {
+			fmt.Println("Error stopping push outbox:", err)
 		}
+		return e.Next()
+	})
 
-		if len(poopSeshes) == 0 {
-			return e.Next()
-		}
+	app.OnRecordAfterCreateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		fmt.Println("Poop sesh created")
+		activeSesh := e.Record
 
-		for _, pooSesh := range poopSeshes {
-			notificationService.SendPushNotification(pooSesh.GetString("poo_profile"), notifications.PoopSesh, notifications.NotificationData{
-				Title:  "Poop Sesh",
-				Body:   "One of your buddies is also pooping",
-				Screen: "/(protected)/(screens)/chat/" + pooSesh.GetString("poo_profile") + "/" + activeSesh.GetString("poo_profile"),
-			}, nil)
-		}
+		// Scan for count/streak/time-of-day achievements on new sesh creation.
+		scanQueue.Enqueue(activeSesh.GetString("poo_profile"), activeSesh.Id)
 
 		return e.Next()
 	})
 
 	app.OnRecordAfterUpdateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
-		// Scan for duration/calculated achievements when a sesh is updated (ended).
-		go scanAndNotifyAchievements(e.Record.GetString("poo_profile"))
+		// Scan for duration/calculated achievements when a sesh is updated (ended),
+		// and take back revocable ones an edited timestamp no longer supports.
+		scanQueue.EnqueueRevalidation(e.Record.GetString("poo_profile"), e.Record.Id)
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		// Take back revocable achievements earned from the deleted sesh.
+		scanQueue.EnqueueRevalidation(e.Record.GetString("poo_profile"), "")
 		return e.Next()
 	})
 
@@ -221,6 +197,9 @@ func main() {
 			return e.JSON(200, "success")
 		})
 
+		achievements.RegisterRoutes(app, se)
+		notifications.RegisterRoutes(app, se)
+
 		// serves static files from the provided public dir (if exists)
 		se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), false))
 
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection := core.NewBaseCollection("achievement_progress", "pbc_1830934311")
+
+		ownerRule := `@request.auth.id != "" && @request.auth.id = poo_profile.user.id`
+		collection.ListRule = types.Pointer(ownerRule)
+		collection.ViewRule = types.Pointer(ownerRule)
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_progress_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_progress_achievement",
+			Name:          "achievement",
+			CollectionId:  "pbc_2260351736",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.NumberField{Id: "number_progress_current", Name: "current"})
+		collection.Fields.Add(&core.NumberField{Id: "number_progress_target", Name: "target"})
+		collection.Fields.Add(&core.NumberField{Id: "number_progress_percent", Name: "percent"})
+		collection.Fields.Add(&core.BoolField{Id: "bool_progress_met", Name: "met"})
+		collection.Fields.Add(&core.JSONField{Id: "json_progress_details", Name: "details"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_progress_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_progress_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_achievement_progress_profile_achievement", true, "`poo_profile`, `achievement`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1830934311")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(&core.NumberField{
+			Id:      "number_achv_min_seshes",
+			Name:    "min_seshes",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+		collection.Fields.Add(&core.NumberField{
+			Id:      "number_achv_min_account_age",
+			Name:    "min_account_age_days",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+
+		// Existing achievements keep the new columns' default of 0, i.e. no
+		// prerequisites. Carrying the old global 10-sesh minimum over would
+		// keep the "first sesh" achievements unearnable; achievements that
+		// need a history are reconfigured individually.
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveById("number_achv_min_seshes")
+		collection.Fields.RemoveById("number_achv_min_account_age")
+
+		return app.Save(collection)
+	})
+}
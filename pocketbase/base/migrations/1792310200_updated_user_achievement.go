@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_554109153")
+		if err != nil {
+			return err
+		}
+
+		// Concurrent scans could grant the same achievement twice; keep the
+		// earliest grant of each pair before enforcing uniqueness.
+		var records []*core.Record
+		err = app.RecordQuery(collection).OrderBy("created ASC", "id ASC").All(&records)
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		for _, record := range records {
+			key := record.GetString("poo_profile") + "/" + record.GetString("achievement")
+			if !seen[key] {
+				seen[key] = true
+				continue
+			}
+			if err := app.Delete(record); err != nil {
+				return err
+			}
+		}
+
+		collection.AddIndex("idx_user_achievement_profile_achievement", true, "`poo_profile`, `achievement`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_554109153")
+		if err != nil {
+			return err
+		}
+
+		collection.RemoveIndex("idx_user_achievement_profile_achievement")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2822695520")
+		if err != nil {
+			return err
+		}
+
+		// Default IANA zone for seshes logged without one.
+		collection.Fields.Add(&core.TextField{
+			Id:   "text_profile_timezone",
+			Name: "timezone",
+		})
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// Start from the zone of each profile's most recent sesh that has one.
+		_, err = app.DB().NewQuery(`
+			UPDATE {{poo_profiles}} SET [[timezone]] = COALESCE((
+				SELECT [[s.timezone]] FROM {{poop_seshes}} s
+				WHERE [[s.poo_profile]] = {{poo_profiles}}.[[id]]
+					AND [[s.timezone]] != '' AND [[s.timezone]] != 'Unknown'
+				ORDER BY [[s.started]] DESC
+				LIMIT 1
+			), '')
+		`).Execute()
+		return err
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2822695520")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveById("text_profile_timezone")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection := core.NewBaseCollection("streaks", "pbc_3620135410")
+
+		ownerRule := `@request.auth.id != "" && @request.auth.id = poo_profile.user.id`
+		collection.ListRule = types.Pointer(ownerRule)
+		collection.ViewRule = types.Pointer(ownerRule)
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_streak_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_streak_period",
+			Name:      "period",
+			Values:    []string{"daily", "weekly", "monthly"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		collection.Fields.Add(&core.NumberField{Id: "number_streak_current", Name: "current", OnlyInt: true})
+		collection.Fields.Add(&core.NumberField{Id: "number_streak_best", Name: "best", OnlyInt: true})
+		collection.Fields.Add(&core.TextField{Id: "text_streak_last_period", Name: "last_period"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_streak_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_streak_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_streaks_profile_period", true, "`poo_profile`, `period`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3620135410")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
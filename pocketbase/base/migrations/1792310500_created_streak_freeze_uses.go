@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		profiles, err := app.FindCollectionByNameOrId("pbc_2822695520")
+		if err != nil {
+			return err
+		}
+		profiles.Fields.Add(&core.NumberField{
+			Id:      "number_profile_streak_freezes",
+			Name:    "streak_freezes",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+		// Freezes are earned, never set by the client.
+		profiles.UpdateRule = types.Pointer(`@request.auth.id != "" && @request.auth.id = user && @request.body.streak_freezes:isset = false`)
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		achievements, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+		achievements.Fields.Add(&core.NumberField{
+			Id:      "number_achv_streak_freeze_reward",
+			Name:    "streak_freeze_reward",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+		if err := app.Save(achievements); err != nil {
+			return err
+		}
+
+		// One record per missed period a streak freeze bridged.
+		collection := core.NewBaseCollection("streak_freeze_uses", "pbc_1172604836")
+
+		ownerRule := `@request.auth.id != "" && @request.auth.id = poo_profile.user.id`
+		collection.ListRule = types.Pointer(ownerRule)
+		collection.ViewRule = types.Pointer(ownerRule)
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_freeze_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_freeze_period",
+			Name:      "period",
+			Values:    []string{"daily", "weekly", "monthly"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_freeze_period_key", Name: "period_key", Required: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_freeze_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_freeze_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_streak_freeze_uses_profile_period", true, "`poo_profile`, `period`, `period_key`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1172604836")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(collection); err != nil {
+			return err
+		}
+
+		achievements, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+		achievements.Fields.RemoveById("number_achv_streak_freeze_reward")
+		if err := app.Save(achievements); err != nil {
+			return err
+		}
+
+		profiles, err := app.FindCollectionByNameOrId("pbc_2822695520")
+		if err != nil {
+			return err
+		}
+		profiles.Fields.RemoveById("number_profile_streak_freezes")
+		profiles.UpdateRule = types.Pointer(`@request.auth.id != "" && @request.auth.id = user`)
+
+		return app.Save(profiles)
+	})
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		achievements, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+		// Ordered tiers, e.g. [{"name": "Bronze", "value": 10}, {"name": "Gold", "value": 100}].
+		achievements.Fields.Add(&core.JSONField{Id: "json_achv_tiers", Name: "tiers"})
+		if err := app.Save(achievements); err != nil {
+			return err
+		}
+
+		userAchievements, err := app.FindCollectionByNameOrId("pbc_554109153")
+		if err != nil {
+			return err
+		}
+		// Highest tier reached (1-based); 0 for untiered achievements.
+		userAchievements.Fields.Add(&core.NumberField{
+			Id:      "number_user_achv_tier",
+			Name:    "tier",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+		return app.Save(userAchievements)
+	}, func(app core.App) error {
+		achievements, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+		achievements.Fields.RemoveById("json_achv_tiers")
+		if err := app.Save(achievements); err != nil {
+			return err
+		}
+
+		userAchievements, err := app.FindCollectionByNameOrId("pbc_554109153")
+		if err != nil {
+			return err
+		}
+		userAchievements.Fields.RemoveById("number_user_achv_tier")
+		return app.Save(userAchievements)
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+
+		// Time-limited events are only scanned between these dates; either
+		// may be left empty for an open-ended window.
+		collection.Fields.Add(&core.DateField{
+			Id:   "date_achv_available_from",
+			Name: "available_from",
+		})
+		collection.Fields.Add(&core.DateField{
+			Id:   "date_achv_available_until",
+			Name: "available_until",
+		})
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveById("date_achv_available_from")
+		collection.Fields.RemoveById("date_achv_available_until")
+
+		return app.Save(collection)
+	})
+}
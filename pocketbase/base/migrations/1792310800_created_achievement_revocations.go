@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		achievements, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+		// Revocable achievements are taken back when the seshes they were
+		// earned from are deleted or edited.
+		achievements.Fields.Add(&core.BoolField{Id: "bool_achv_revocable", Name: "revocable"})
+		if err := app.Save(achievements); err != nil {
+			return err
+		}
+
+		// Audit log of revoked and downgraded grants.
+		collection := core.NewBaseCollection("achievement_revocations", "pbc_2493017765")
+
+		ownerRule := `@request.auth.id != "" && @request.auth.id = poo_profile.user.id`
+		collection.ListRule = types.Pointer(ownerRule)
+		collection.ViewRule = types.Pointer(ownerRule)
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_revocation_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_revocation_achievement",
+			Name:          "achievement",
+			CollectionId:  "pbc_2260351736",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.BoolField{Id: "bool_revocation_removed", Name: "removed"})
+		collection.Fields.Add(&core.NumberField{Id: "number_revocation_from_tier", Name: "from_tier", OnlyInt: true})
+		collection.Fields.Add(&core.NumberField{Id: "number_revocation_to_tier", Name: "to_tier", OnlyInt: true})
+		collection.Fields.Add(&core.TextField{Id: "text_revocation_reason", Name: "reason"})
+		collection.Fields.Add(&core.JSONField{Id: "json_revocation_details", Name: "details"})
+		collection.Fields.Add(&core.DateField{Id: "date_revocation_unlocked_at", Name: "unlocked_at"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_revocation_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_revocation_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_achievement_revocations_profile", false, "`poo_profile`, `created`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2493017765")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(collection); err != nil {
+			return err
+		}
+
+		achievements, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+		achievements.Fields.RemoveById("bool_achv_revocable")
+		return app.Save(achievements)
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+
+		// Rarity cache, refreshed periodically from user_achievement.
+		collection.Fields.Add(&core.NumberField{
+			Id:      "number_achv_unlock_count",
+			Name:    "unlock_count",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+		collection.Fields.Add(&core.NumberField{
+			Id:   "number_achv_unlock_percent",
+			Name: "unlock_percent",
+			Min:  types.Pointer(0.0),
+			Max:  types.Pointer(100.0),
+		})
+		collection.Fields.Add(&core.DateField{
+			Id:   "date_achv_rarity_updated",
+			Name: "rarity_updated",
+		})
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2260351736")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveById("number_achv_unlock_count")
+		collection.Fields.RemoveById("number_achv_unlock_percent")
+		collection.Fields.RemoveById("date_achv_rarity_updated")
+
+		return app.Save(collection)
+	})
+}
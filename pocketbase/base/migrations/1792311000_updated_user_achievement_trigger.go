@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_554109153")
+		if err != nil {
+			return err
+		}
+
+		// The sesh whose scan made (or last upgraded) the grant. Cleared when
+		// the sesh is deleted.
+		collection.Fields.Add(&core.RelationField{
+			Id:           "relation_user_achv_sesh",
+			Name:         "poop_sesh",
+			CollectionId: "pbc_2365814001",
+			MaxSelect:    1,
+		})
+		// The evaluation the grant was made on.
+		collection.Fields.Add(&core.JSONField{Id: "json_user_achv_snapshot", Name: "snapshot"})
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_554109153")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveById("relation_user_achv_sesh")
+		collection.Fields.RemoveById("json_user_achv_snapshot")
+
+		return app.Save(collection)
+	})
+}
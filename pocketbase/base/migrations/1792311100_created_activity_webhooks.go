@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		eventTypes := []string{
+			"sesh.started", "sesh.ended", "follow.requested", "follow.approved",
+			"achievement.earned", "achievement.upgraded", "achievement.revoked",
+		}
+
+		// Activity feed, written by the event bus. Visible to the profile and
+		// to its approved followers.
+		activity := core.NewBaseCollection("activity", "pbc_1488250421")
+
+		feedRule := `@request.auth.id != "" && (poo_profile.user = @request.auth.id || (` +
+			`@collection.follows.follower.user ?= @request.auth.id && ` +
+			`@collection.follows.following ?= poo_profile && ` +
+			`@collection.follows.status ?= "approved"))`
+		activity.ListRule = types.Pointer(feedRule)
+		activity.ViewRule = types.Pointer(feedRule)
+
+		activity.Fields.Add(&core.RelationField{
+			Id:            "relation_activity_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		activity.Fields.Add(&core.SelectField{
+			Id:        "select_activity_type",
+			Name:      "type",
+			Values:    eventTypes,
+			MaxSelect: 1,
+			Required:  true,
+		})
+		activity.Fields.Add(&core.TextField{Id: "text_activity_event_id", Name: "event_id"})
+		activity.Fields.Add(&core.JSONField{Id: "json_activity_data", Name: "data"})
+		activity.Fields.Add(&core.AutodateField{Id: "autodate_activity_created", Name: "created", OnCreate: true})
+		activity.Fields.Add(&core.AutodateField{Id: "autodate_activity_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		activity.AddIndex("idx_activity_profile_created", false, "`poo_profile`, `created`", "")
+
+		if err := app.Save(activity); err != nil {
+			return err
+		}
+
+		// Outbound webhooks, managed by superusers only.
+		webhooks := core.NewBaseCollection("webhooks", "pbc_3940114519")
+
+		webhooks.Fields.Add(&core.TextField{Id: "text_webhook_name", Name: "name", Required: true})
+		webhooks.Fields.Add(&core.URLField{Id: "url_webhook_url", Name: "url", Required: true})
+		webhooks.Fields.Add(&core.TextField{
+			Id:       "text_webhook_secret",
+			Name:     "secret",
+			Min:      16,
+			Required: true,
+			Hidden:   true,
+		})
+		// Event types to deliver, e.g. ["achievement.earned"]; empty for all.
+		webhooks.Fields.Add(&core.JSONField{Id: "json_webhook_events", Name: "events"})
+		webhooks.Fields.Add(&core.BoolField{Id: "bool_webhook_active", Name: "active"})
+		webhooks.Fields.Add(&core.AutodateField{Id: "autodate_webhook_created", Name: "created", OnCreate: true})
+		webhooks.Fields.Add(&core.AutodateField{Id: "autodate_webhook_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		return app.Save(webhooks)
+	}, func(app core.App) error {
+		for _, id := range []string{"pbc_3940114519", "pbc_1488250421"} {
+			collection, err := app.FindCollectionByNameOrId(id)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// One row per notification type and channel a profile changed from the
+		// default; missing rows use the defaults in the notifications package.
+		collection := core.NewBaseCollection("notification_preferences", "pbc_2907262013")
+
+		ownerRule := `@request.auth.id != "" && @request.auth.id = poo_profile.user.id`
+		collection.ListRule = types.Pointer(ownerRule)
+		collection.ViewRule = types.Pointer(ownerRule)
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_notif_pref_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_notif_pref_type",
+			Name:      "type",
+			Values:    []string{"poop_sesh", "achievement"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_notif_pref_channel",
+			Name:      "channel",
+			Values:    []string{"push"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		collection.Fields.Add(&core.BoolField{Id: "bool_notif_pref_enabled", Name: "enabled"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_notif_pref_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_notif_pref_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_notification_preferences_profile_type_channel", true, "`poo_profile`, `type`, `channel`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2907262013")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Every device a profile receives pushes on. Registered through the
+		// /api/push-devices endpoints.
+		collection := core.NewBaseCollection("push_devices", "pbc_1043620583")
+
+		ownerRule := `@request.auth.id != "" && @request.auth.id = poo_profile.user.id`
+		collection.ListRule = types.Pointer(ownerRule)
+		collection.ViewRule = types.Pointer(ownerRule)
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_push_device_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_push_device_token", Name: "token", Required: true, Hidden: true})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_push_device_platform",
+			Name:      "platform",
+			Values:    []string{"ios", "android", "web"},
+			MaxSelect: 1,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_push_device_app_version", Name: "app_version", Max: 50})
+		collection.Fields.Add(&core.DateField{Id: "date_push_device_last_seen", Name: "last_seen"})
+		collection.Fields.Add(&core.BoolField{Id: "bool_push_device_active", Name: "active"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_push_device_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_push_device_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_push_devices_token", true, "`token`", "")
+		collection.AddIndex("idx_push_devices_profile", false, "`poo_profile`", "")
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// Carry over the single token profiles had so far.
+		profiles, err := app.FindAllRecords("poo_profiles", dbx.NewExp("expo_push_token != ''"))
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		for _, profile := range profiles {
+			token := strings.TrimSpace(profile.GetString("expo_push_token"))
+			if token == "" || seen[token] {
+				continue
+			}
+			seen[token] = true
+
+			device := core.NewRecord(collection)
+			device.Set("poo_profile", profile.Id)
+			device.Set("token", token)
+			device.Set("last_seen", profile.GetDateTime("updated"))
+			device.Set("active", true)
+			if err := app.Save(device); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1043620583")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
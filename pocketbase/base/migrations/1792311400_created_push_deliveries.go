@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// One row per push message sent to a device: its Expo ticket and, once
+		// the receipt is fetched, whether it was delivered. Superusers only.
+		collection := core.NewBaseCollection("push_deliveries", "pbc_3357120877")
+
+		collection.Fields.Add(&core.TextField{Id: "text_push_delivery_notification", Name: "notification_id", Required: true})
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_push_delivery_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		// Empty for the legacy token stored on the profile.
+		collection.Fields.Add(&core.RelationField{
+			Id:           "relation_push_delivery_device",
+			Name:         "device",
+			CollectionId: "pbc_1043620583",
+			MaxSelect:    1,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_push_delivery_token", Name: "token", Hidden: true})
+		collection.Fields.Add(&core.TextField{Id: "text_push_delivery_type", Name: "type"})
+		collection.Fields.Add(&core.TextField{Id: "text_push_delivery_title", Name: "title"})
+		collection.Fields.Add(&core.TextField{Id: "text_push_delivery_ticket", Name: "ticket_id"})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_push_delivery_status",
+			Name:      "status",
+			Values:    []string{"sent", "delivered", "failed", "expired"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_push_delivery_error", Name: "error"})
+		collection.Fields.Add(&core.TextField{Id: "text_push_delivery_message", Name: "message"})
+		collection.Fields.Add(&core.DateField{Id: "date_push_delivery_receipt_checked", Name: "receipt_checked"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_push_delivery_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_push_delivery_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_push_deliveries_status_created", false, "`status`, `created`", "")
+		collection.AddIndex("idx_push_deliveries_notification", false, "`notification_id`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3357120877")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// The in-app inbox: every notification sent to a profile, pushed or
+		// not. Recipients can list, view and subscribe to their own; they are
+		// marked read through the notifications API.
+		collection := core.NewBaseCollection("notifications", "pbc_2301922722")
+
+		ownerRule := `@request.auth.id != "" && @request.auth.id = poo_profile.user.id`
+		collection.ListRule = types.Pointer(ownerRule)
+		collection.ViewRule = types.Pointer(ownerRule)
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_notification_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_notification_type",
+			Name:      "type",
+			Values:    []string{"poop_sesh", "achievement"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_notification_title", Name: "title"})
+		collection.Fields.Add(&core.TextField{Id: "text_notification_body", Name: "body"})
+		collection.Fields.Add(&core.TextField{Id: "text_notification_screen", Name: "screen"})
+		collection.Fields.Add(&core.JSONField{Id: "json_notification_data", Name: "data", MaxSize: 10000})
+		// Empty while unread.
+		collection.Fields.Add(&core.DateField{Id: "date_notification_read_at", Name: "read_at"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_notification_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_notification_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_notifications_profile_created", false, "`poo_profile`, `created`", "")
+		collection.AddIndex("idx_notifications_profile_read_at", false, "`poo_profile`, `read_at`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2301922722")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
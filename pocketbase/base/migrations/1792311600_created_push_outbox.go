@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Pushes waiting to be sent, queued in the transaction of the write
+		// that caused them. Entries that keep failing end up dead until they
+		// are replayed. Superusers only.
+		collection := core.NewBaseCollection("push_outbox", "pbc_1739451806")
+
+		collection.Fields.Add(&core.RelationField{
+			Id:            "relation_push_outbox_profile",
+			Name:          "poo_profile",
+			CollectionId:  "pbc_2822695520",
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_push_outbox_notification", Name: "notification_id"})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_push_outbox_type",
+			Name:      "type",
+			Values:    []string{"poop_sesh", "achievement"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		collection.Fields.Add(&core.TextField{Id: "text_push_outbox_title", Name: "title"})
+		collection.Fields.Add(&core.TextField{Id: "text_push_outbox_body", Name: "body"})
+		collection.Fields.Add(&core.TextField{Id: "text_push_outbox_screen", Name: "screen"})
+		collection.Fields.Add(&core.JSONField{Id: "json_push_outbox_data", Name: "data", MaxSize: 10000})
+		collection.Fields.Add(&core.SelectField{
+			Id:        "select_push_outbox_status",
+			Name:      "status",
+			Values:    []string{"pending", "sent", "skipped", "dead"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		// Tokens Expo accepted the push for, and tokens that failed for good;
+		// retries only go to the profile's other devices.
+		collection.Fields.Add(&core.JSONField{Id: "json_push_outbox_sent_to", Name: "sent_to", Hidden: true, MaxSize: 100000})
+		collection.Fields.Add(&core.JSONField{Id: "json_push_outbox_failed_to", Name: "failed_to", Hidden: true, MaxSize: 100000})
+		collection.Fields.Add(&core.NumberField{Id: "number_push_outbox_attempts", Name: "attempts", Min: types.Pointer(0.0), OnlyInt: true})
+		collection.Fields.Add(&core.DateField{Id: "date_push_outbox_next_attempt", Name: "next_attempt"})
+		collection.Fields.Add(&core.TextField{Id: "text_push_outbox_last_error", Name: "last_error"})
+		collection.Fields.Add(&core.DateField{Id: "date_push_outbox_sent_at", Name: "sent_at"})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_push_outbox_created", Name: "created", OnCreate: true})
+		collection.Fields.Add(&core.AutodateField{Id: "autodate_push_outbox_updated", Name: "updated", OnCreate: true, OnUpdate: true})
+
+		collection.AddIndex("idx_push_outbox_status_next_attempt", false, "`status`, `next_attempt`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1739451806")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2365814001")
+		if err != nil {
+			return err
+		}
+
+		// Meters above sea level as reported by the device's location
+		// services; 0 when it reported none.
+		collection.Fields.Add(&core.NumberField{Id: "number_poop_altitude", Name: "altitude"})
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2365814001")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveById("number_poop_altitude")
+
+		return app.Save(collection)
+	})
+}
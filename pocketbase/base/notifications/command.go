@@ -0,0 +1,97 @@
+package notifications
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// NewCommand returns the `notifications` command with its `replay`
+// subcommand.
+func NewCommand(app *pocketbase.PocketBase) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "notifications",
+		Short: "Manage push notifications",
+	}
+
+	command.AddCommand(newReplayCommand(app))
+
+	return command
+}
+
+func newReplayCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var (
+		entryId   string
+		profileId string
+		dryRun    bool
+	)
+
+	command := &cobra.Command{
+		Use:   "replay",
+		Short: "Requeue dead pushes",
+		Long: "Requeues the pushes in the outbox that failed too often (or a single one) with\n" +
+			"a fresh set of attempts for every device that has not got them yet. The running\n" +
+			"server sends them within a few seconds.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := dbx.HashExp{"status": OutboxDead}
+			if entryId != "" {
+				filter["id"] = entryId
+			}
+			if profileId != "" {
+				filter["poo_profile"] = profileId
+			}
+
+			dead, err := app.FindAllRecords("push_outbox", filter)
+			if err != nil {
+				return fmt.Errorf("getting dead pushes: %w", err)
+			}
+			if entryId != "" && len(dead) == 0 {
+				return fmt.Errorf("push %q not found or not dead", entryId)
+			}
+
+			verb := "requeued"
+			if dryRun {
+				verb = "would requeue"
+			}
+
+			err = app.RunInTransaction(func(txApp core.App) error {
+				for _, entry := range dead {
+					cmd.Printf("%s %q to profile %s (%d attempts, %s)\n", verb, entry.GetString("title"),
+						entry.GetString("poo_profile"), entry.GetInt("attempts"), entry.GetString("last_error"))
+					if dryRun {
+						continue
+					}
+
+					// Devices that already got the push are left out again;
+					// the ones that failed for good get another chance.
+					entry.Set("status", OutboxPending)
+					entry.Set("failed_to", nil)
+					entry.Set("attempts", 0)
+					entry.Set("next_attempt", types.NowDateTime())
+					if err := txApp.Save(entry); err != nil {
+						return fmt.Errorf("requeueing push %s: %w", entry.Id, err)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			cmd.Printf("Done: %d pushes %s\n", len(dead), verb)
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&entryId, "id", "", "only replay this push_outbox id")
+	command.Flags().StringVar(&profileId, "profile", "", "only replay pushes to this poo profile id")
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "list the pushes that would be requeued")
+
+	return command
+}
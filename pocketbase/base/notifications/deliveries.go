@@ -0,0 +1,248 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// receiptsCronSchedule is how often pending receipts are fetched.
+	receiptsCronSchedule = "*/10 * * * *"
+	// receiptDelay is how long after sending a receipt is first asked for.
+	// Expo usually has it well before then.
+	receiptDelay = 15 * time.Minute
+	// receiptExpiry is how long Expo keeps receipts. Deliveries still
+	// waiting for one after that are marked expired.
+	receiptExpiry = 24 * time.Hour
+	// receiptBatchSize is the most ticket ids Expo accepts in one request.
+	receiptBatchSize = 1000
+)
+
+// Delivery statuses stored in push_deliveries.
+const (
+	DeliverySent      = "sent"      // accepted by Expo, waiting for the receipt
+	DeliveryDelivered = "delivered" // handed to Apple or Google
+	DeliveryFailed    = "failed"
+	DeliveryExpired   = "expired" // no receipt before Expo dropped it
+)
+
+// delivery is what the push_deliveries rows of one notification share.
+// notificationId is the id of the notification in the inbox.
+type delivery struct {
+	notificationId string
+	profileId      string
+	notification   NotificationType
+	title          string
+}
+
+func newDelivery(notificationId, profileId string, notificationType NotificationType, title string) delivery {
+	return delivery{
+		notificationId: notificationId,
+		profileId:      profileId,
+		notification:   notificationType,
+		title:          title,
+	}
+}
+
+// recordDelivery stores the ticket Expo returned for the message to device.
+// Failing to store it only costs the delivery status, so errors are logged.
+func (s *NotificationService) recordDelivery(d delivery, device pushDevice, ticket expo.PushResponse) {
+	collection, err := s.app.FindCachedCollectionByNameOrId("push_deliveries")
+	if err != nil {
+		log.Printf("Error recording push delivery: %v", err)
+		return
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("notification_id", d.notificationId)
+	record.Set("poo_profile", d.profileId)
+	record.Set("device", device.id)
+	record.Set("token", string(device.token))
+	record.Set("type", d.notification.String())
+	record.Set("title", d.title)
+	if ticket.Status == expo.SuccessStatus {
+		record.Set("status", DeliverySent)
+		record.Set("ticket_id", ticket.ID)
+	} else {
+		record.Set("status", DeliveryFailed)
+		record.Set("error", ticket.Details["error"])
+		record.Set("message", ticket.Message)
+	}
+	if err := s.app.Save(record); err != nil {
+		log.Printf("Error recording push delivery to %s of profile %s: %v", device, d.profileId, err)
+	}
+}
+
+// disableToken stops pushes to a token Expo reports as no longer
+// registered: the device is deactivated, or the legacy token cleared from
+// its profile. The app registers the device again when it gets a new token.
+func (s *NotificationService) disableToken(deviceId, token string) error {
+	if deviceId != "" {
+		device, err := s.app.FindRecordById("push_devices", deviceId)
+		if err != nil {
+			// Already deleted.
+			return nil
+		}
+		if !device.GetBool("active") {
+			return nil
+		}
+		device.Set("active", false)
+		return s.app.Save(device)
+	}
+
+	profiles, err := s.app.FindAllRecords("poo_profiles", dbx.HashExp{"expo_push_token": token})
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		profile.Set("expo_push_token", "")
+		if err := s.app.Save(profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterCron schedules the push receipt checks.
+func RegisterCron(app *pocketbase.PocketBase) {
+	app.Cron().MustAdd("pushReceipts", receiptsCronSchedule, func() {
+		if err := NewNotificationService(app).CheckReceipts(); err != nil {
+			log.Printf("Error checking push receipts: %v", err)
+		}
+	})
+}
+
+// CheckReceipts fetches the Expo receipts of the deliveries sent at least
+// receiptDelay ago and records whether they were delivered. Tokens whose
+// receipt says DeviceNotRegistered are disabled. Deliveries Expo has no
+// receipt for yet are checked again on the next run, until they expire.
+func (s *NotificationService) CheckReceipts() error {
+	started := types.NowDateTime()
+	sentBefore := started.Add(-receiptDelay)
+	expiredBefore := started.Add(-receiptExpiry)
+
+	for {
+		// Every record fetched gets receipt_checked set, so each run looks
+		// at every pending delivery once.
+		pending, err := s.app.FindRecordsByFilter(
+			"push_deliveries",
+			"status = {:status} && ticket_id != '' && created <= {:sentBefore} && (receipt_checked = '' || receipt_checked < {:started})",
+			"created",
+			receiptBatchSize,
+			0,
+			dbx.Params{"status": DeliverySent, "sentBefore": sentBefore, "started": started},
+		)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(pending))
+		for i, record := range pending {
+			ids[i] = record.GetString("ticket_id")
+		}
+		receipts, err := s.fetchReceipts(ids)
+		if err != nil {
+			return fmt.Errorf("error fetching receipts: %w", err)
+		}
+
+		for _, record := range pending {
+			receipt, ok := receipts[record.GetString("ticket_id")]
+			switch {
+			case ok && receipt.Status == expo.SuccessStatus:
+				record.Set("status", DeliveryDelivered)
+			case ok:
+				record.Set("status", DeliveryFailed)
+				record.Set("error", receipt.error())
+				record.Set("message", receipt.Message)
+				if receipt.error() == expo.ErrorDeviceNotRegistered {
+					if err := s.disableToken(record.GetString("device"), record.GetString("token")); err != nil {
+						log.Printf("Error disabling push token of delivery %s: %v", record.Id, err)
+					}
+				}
+			case record.GetDateTime("created").Before(expiredBefore):
+				record.Set("status", DeliveryExpired)
+			}
+			record.Set("receipt_checked", types.NowDateTime())
+			if err := s.app.Save(record); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) < receiptBatchSize {
+			return nil
+		}
+	}
+}
+
+// pushReceipt is one entry of Expo's getReceipts response.
+type pushReceipt struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details"`
+}
+
+func (r pushReceipt) error() string {
+	if e, ok := r.Details["error"].(string); ok && e != "" {
+		return e
+	}
+	return "Error"
+}
+
+// fetchReceipts asks Expo for the receipts of the given tickets. Tickets
+// without a receipt yet are missing from the result.
+func (s *NotificationService) fetchReceipts(ids []string) (map[string]pushReceipt, error) {
+	body, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.expoHost+expo.DefaultBaseAPIURL+"/push/getReceipts", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accessToken)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data   map[string]pushReceipt `json:"data"`
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("%s: %s", result.Errors[0].Code, result.Errors[0].Message)
+	}
+	return result.Data, nil
+}
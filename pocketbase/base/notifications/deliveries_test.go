@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// backdateDeliveries makes every delivery look sent age ago, and any
+// receipt check look as old, so the next CheckReceipts looks at them again.
+func backdateDeliveries(t *testing.T, app core.App, age time.Duration) {
+	t.Helper()
+	_, err := app.DB().NewQuery("UPDATE push_deliveries SET created = {:created}, receipt_checked = CASE WHEN receipt_checked = '' THEN '' ELSE {:created} END").
+		Bind(map[string]any{"created": types.NowDateTime().Add(-age).String()}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deliveryStatuses(t *testing.T, app core.App) map[string]string {
+	t.Helper()
+	records, err := app.FindAllRecords("push_deliveries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, record := range records {
+		statuses[record.GetString("token")] = record.GetString("status")
+	}
+	return statuses
+}
+
+func TestReceiptDeviceNotRegisteredDisablesToken(t *testing.T) {
+	expo := newFakeExpo(t)
+	app := apptest.NewApp(t)
+	service := NewNotificationService(app)
+
+	const legacyToken = "ExponentPushToken[legacy]"
+	profile := apptest.NewProfile(t, app, "receipts", nil)
+	for _, token := range []string{phoneToken, tabletToken} {
+		if _, err := service.RegisterDevice(profile.Id, DeviceRegistration{Token: token}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	legacy := apptest.NewProfile(t, app, "legacy", map[string]any{"expo_push_token": legacyToken})
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	service.SendPushNotification(legacy.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	deliverDue(t, service)
+
+	statuses := deliveryStatuses(t, app)
+	if len(statuses) != 3 {
+		t.Fatalf("deliveries %v, want one per token", statuses)
+	}
+	for token, status := range statuses {
+		if status != DeliverySent {
+			t.Errorf("%s: %s before the receipts, want sent", token, status)
+		}
+	}
+
+	// Too early to ask.
+	if err := service.CheckReceipts(); err != nil {
+		t.Fatal(err)
+	}
+	if len(expo.receiptIds) != 0 {
+		t.Fatalf("asked for receipts %v right after sending", expo.receiptIds)
+	}
+
+	expo.receipts["ticket-"+phoneToken] = map[string]any{"status": "ok"}
+	expo.receipts["ticket-"+tabletToken] = errorTicket("DeviceNotRegistered")
+	expo.receipts["ticket-"+legacyToken] = errorTicket("DeviceNotRegistered")
+	backdateDeliveries(t, app, receiptDelay+time.Minute)
+	if err := service.CheckReceipts(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{phoneToken: DeliveryDelivered, tabletToken: DeliveryFailed, legacyToken: DeliveryFailed}
+	for token, status := range deliveryStatuses(t, app) {
+		if status != want[token] {
+			t.Errorf("%s: %s, want %s", token, status, want[token])
+		}
+	}
+
+	phone, _ := app.FindFirstRecordByData("push_devices", "token", phoneToken)
+	tablet, _ := app.FindFirstRecordByData("push_devices", "token", tabletToken)
+	if !phone.GetBool("active") || tablet.GetBool("active") {
+		t.Errorf("phone active %v, tablet active %v; want only the tablet disabled", phone.GetBool("active"), tablet.GetBool("active"))
+	}
+	legacy, _ = app.FindRecordById("poo_profiles", legacy.Id)
+	if token := legacy.GetString("expo_push_token"); token != "" {
+		t.Errorf("legacy token %q not cleared", token)
+	}
+
+	// The next push only goes to the phone.
+	expo.sentTokens()
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Again"}, nil)
+	service.SendPushNotification(legacy.Id, Achievement, NotificationData{Title: "Again"}, nil)
+	deliverDue(t, service)
+	if sent := expo.sentTokens(); len(sent) != 1 || sent[0] != phoneToken {
+		t.Errorf("sent to %v, want only the phone", sent)
+	}
+}
+
+func TestReceiptsPendingUntilExpired(t *testing.T) {
+	expo := newFakeExpo(t)
+	app := apptest.NewApp(t)
+	service := NewNotificationService(app)
+	profile := apptest.NewProfile(t, app, "waiting", map[string]any{"expo_push_token": "ExponentPushToken[waiting]"})
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	deliverDue(t, service)
+
+	backdateDeliveries(t, app, receiptDelay+time.Minute)
+	if err := service.CheckReceipts(); err != nil {
+		t.Fatal(err)
+	}
+	if len(expo.receiptIds) != 1 {
+		t.Fatalf("asked for %v, want the one ticket", expo.receiptIds)
+	}
+	for token, status := range deliveryStatuses(t, app) {
+		if status != DeliverySent {
+			t.Errorf("%s: %s without a receipt, want still sent", token, status)
+		}
+	}
+
+	backdateDeliveries(t, app, receiptExpiry+time.Minute)
+	if err := service.CheckReceipts(); err != nil {
+		t.Fatal(err)
+	}
+	for token, status := range deliveryStatuses(t, app) {
+		if status != DeliveryExpired {
+			t.Errorf("%s: %s, want expired", token, status)
+		}
+	}
+}
+
+func TestReceiptsRequestFailure(t *testing.T) {
+	expo := newFakeExpo(t)
+	app := apptest.NewApp(t)
+	service := NewNotificationService(app)
+	profile := apptest.NewProfile(t, app, "flaky", map[string]any{"expo_push_token": "ExponentPushToken[flaky]"})
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	deliverDue(t, service)
+	backdateDeliveries(t, app, receiptDelay+time.Minute)
+
+	expo.failRequests = 1
+	if err := service.CheckReceipts(); err == nil {
+		t.Error("want the failed request reported")
+	}
+	expo.receipts["ticket-ExponentPushToken[flaky]"] = map[string]any{"status": "ok"}
+	if err := service.CheckReceipts(); err != nil {
+		t.Fatal(err)
+	}
+	for token, status := range deliveryStatuses(t, app) {
+		if status != DeliveryDelivered {
+			t.Errorf("%s: %s, want delivered", token, status)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package notifications
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// expoBatchSize is the most messages Expo accepts in one request.
+const expoBatchSize = 100
+
+// Platforms a push device can run on.
+var Platforms = []string{"ios", "android", "web"}
+
+// DeviceRegistration describes a device asking for pushes.
+type DeviceRegistration struct {
+	Token      string `json:"token"`
+	Platform   string `json:"platform"`
+	AppVersion string `json:"appVersion"`
+}
+
+// Validate checks the token format and platform.
+func (d DeviceRegistration) Validate() error {
+	if _, err := expo.NewExponentPushToken(d.Token); err != nil {
+		return err
+	}
+	if d.Platform != "" && !slices.Contains(Platforms, d.Platform) {
+		return fmt.Errorf("unknown platform %q", d.Platform)
+	}
+	if len(d.AppVersion) > 50 {
+		return errors.New("appVersion is too long")
+	}
+	return nil
+}
+
+// RegisterDevice adds the device to the profile, or refreshes it when the
+// token is known. A token registered by another profile moves over: the
+// device changed hands or accounts.
+func (s *NotificationService) RegisterDevice(profileId string, device DeviceRegistration) (*core.Record, error) {
+	device.Token = strings.TrimSpace(device.Token)
+	if err := device.Validate(); err != nil {
+		return nil, err
+	}
+
+	collection, err := s.app.FindCachedCollectionByNameOrId("push_devices")
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.app.FindFirstRecordByData(collection, "token", device.Token)
+	if errors.Is(err, sql.ErrNoRows) {
+		record = core.NewRecord(collection)
+		record.Set("token", device.Token)
+	} else if err != nil {
+		return nil, err
+	}
+
+	record.Set("poo_profile", profileId)
+	record.Set("platform", device.Platform)
+	record.Set("app_version", device.AppVersion)
+	record.Set("last_seen", types.NowDateTime())
+	record.Set("active", true)
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// UnregisterDevice removes the profile's device with the token, e.g. on
+// logout. Unknown tokens are ignored.
+func (s *NotificationService) UnregisterDevice(profileId, token string) error {
+	record, err := s.app.FindFirstRecordByFilter(
+		"push_devices",
+		"poo_profile = {:profileId} && token = {:token}",
+		dbx.Params{"profileId": profileId, "token": strings.TrimSpace(token)},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.app.Delete(record)
+}
+
+// pushDevice is a token pushes are sent to. id is empty for the legacy
+// token stored on the profile.
+type pushDevice struct {
+	id    string
+	token expo.ExponentPushToken
+}
+
+func (d pushDevice) String() string {
+	if d.id == "" {
+		return "profile push token"
+	}
+	return "device " + d.id
+}
+
+// pushDevices returns the profile's active devices, plus the token older app
+// versions still store on the profile when no device has it.
+func (s *NotificationService) pushDevices(profileId string) ([]pushDevice, error) {
+	records, err := s.app.FindAllRecords("push_devices", dbx.HashExp{"poo_profile": profileId, "active": true})
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]pushDevice, 0, len(records)+1)
+	for _, r := range records {
+		devices = append(devices, pushDevice{id: r.Id, token: expo.ExponentPushToken(r.GetString("token"))})
+	}
+
+	profile, err := s.app.FindRecordById("poo_profiles", profileId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting player profile: %w", err)
+	}
+	legacy := strings.TrimSpace(profile.GetString("expo_push_token"))
+	if legacy == "" {
+		return devices, nil
+	}
+	if _, err := s.app.FindFirstRecordByData("push_devices", "token", legacy); err == nil {
+		// Registered (possibly disabled or moved to another profile).
+		return devices, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if token, err := expo.NewExponentPushToken(legacy); err == nil {
+		devices = append(devices, pushDevice{token: token})
+	}
+	return devices, nil
+}
@@ -0,0 +1,91 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeExpo is a local stand-in for the Expo push API. tickets maps a token
+// to the ticket its message gets, receipts a ticket id to its receipt;
+// tokens without a ticket get an ok one with the id "ticket-<token>".
+// failRequests makes the next requests fail with a 500.
+type fakeExpo struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	tickets      map[string]map[string]any
+	receipts     map[string]map[string]any
+	failRequests int
+	sent         []string // tokens, in order
+	receiptIds   []string
+}
+
+// newFakeExpo starts a fake Expo server and points EXPO_HOST at it.
+func newFakeExpo(t testing.TB) *fakeExpo {
+	f := &fakeExpo{tickets: map[string]map[string]any{}, receipts: map[string]map[string]any{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	t.Setenv("EXPO_HOST", f.URL)
+	return f
+}
+
+func (f *fakeExpo) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if f.failRequests > 0 {
+		f.failRequests--
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/push/getReceipts") {
+		var request struct {
+			Ids []string `json:"ids"`
+		}
+		json.Unmarshal(body, &request)
+		f.receiptIds = append(f.receiptIds, request.Ids...)
+		data := map[string]any{}
+		for _, id := range request.Ids {
+			if receipt, ok := f.receipts[id]; ok {
+				data[id] = receipt
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+		return
+	}
+
+	var messages []struct {
+		To []string `json:"to"`
+	}
+	json.Unmarshal(body, &messages)
+	data := make([]map[string]any, len(messages))
+	for i, message := range messages {
+		token := message.To[0]
+		f.sent = append(f.sent, token)
+		if ticket, ok := f.tickets[token]; ok {
+			data[i] = ticket
+		} else {
+			data[i] = map[string]any{"status": "ok", "id": "ticket-" + token}
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func (f *fakeExpo) sentTokens() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sent := f.sent
+	f.sent = nil
+	return sent
+}
+
+func errorTicket(code string) map[string]any {
+	return map[string]any{"status": "error", "message": code, "details": map[string]string{"error": code}}
+}
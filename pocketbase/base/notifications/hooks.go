@@ -0,0 +1,130 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"loglog/achievements"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterHooks queues the push notifications caused by new seshes and
+// achievement grants. Achievement pushes are queued in the transaction that
+// saves the grant, so a failure to queue them fails the grant too. Buddy
+// pings are a courtesy: they are queued after the sesh is committed, so
+// neither their errors nor the follower lookup hold up the sesh.
+func RegisterHooks(app *pocketbase.PocketBase) {
+	service := NewNotificationService(app)
+
+	app.OnRecordAfterCreateSuccess("poop_seshes").BindFunc(func(e *core.RecordEvent) error {
+		if err := service.notifyPoopingBuddies(e.App, e.Record); err != nil {
+			log.Printf("Error queueing buddy pushes for sesh %s: %v", e.Record.Id, err)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreate("user_achievement").BindFunc(func(e *core.RecordEvent) error {
+		if achievements.IsQuiet(e.Context) {
+			return e.Next()
+		}
+		return saveWith(e, func(txApp core.App) error {
+			return service.notifyAchievement(txApp, e.Record, false)
+		})
+	})
+
+	app.OnRecordUpdate("user_achievement").BindFunc(func(e *core.RecordEvent) error {
+		upgraded := e.Record.GetInt("tier") > e.Record.Original().GetInt("tier")
+		if !upgraded || achievements.IsQuiet(e.Context) {
+			return e.Next()
+		}
+		return saveWith(e, func(txApp core.App) error {
+			return service.notifyAchievement(txApp, e.Record, true)
+		})
+	})
+}
+
+// saveWith finishes saving the event's record and then runs enqueue, both
+// in one transaction (the caller's, if the record is saved in one).
+func saveWith(e *core.RecordEvent, enqueue func(txApp core.App) error) error {
+	return e.App.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+		if err := e.Next(); err != nil {
+			return err
+		}
+		return enqueue(txApp)
+	})
+}
+
+// notifyAchievement tells the profile about an achievement it earned or
+// upgraded to a higher tier.
+func (s *NotificationService) notifyAchievement(txApp core.App, grant *core.Record, upgraded bool) error {
+	achievement, err := txApp.FindRecordById("achievements", grant.GetString("achievement"))
+	if err != nil {
+		return fmt.Errorf("error fetching achievement for notification: %w", err)
+	}
+
+	// Grants made outside a scan have no snapshot, and so no tier name.
+	var snapshot achievements.GrantSnapshot
+	grant.UnmarshalJSONField("snapshot", &snapshot)
+
+	data := NotificationData{
+		Title:  "Achievement Unlocked!",
+		Body:   "You earned: " + achievement.GetString("name"),
+		Screen: "/(protected)/(tabs)/achievements",
+	}
+	if upgraded {
+		data.Title = "Achievement Upgraded!"
+		data.Body = achievement.GetString("name") + " upgraded to " + snapshot.TierName
+	} else if snapshot.TierName != "" {
+		data.Body += " (" + snapshot.TierName + ")"
+	}
+
+	return s.Enqueue(txApp, grant.GetString("poo_profile"), Achievement, data, nil)
+}
+
+// notifyPoopingBuddies tells the followers of the sesh's profile that are
+// pooping themselves right now. Every buddy's push is queued on its own.
+func (s *NotificationService) notifyPoopingBuddies(app core.App, sesh *core.Record) error {
+	profileId := sesh.GetString("poo_profile")
+
+	// Get poo pals that follow you
+	followers, err := app.FindAllRecords("follows", dbx.NewExp("following = {:following}", dbx.Params{"following": profileId}))
+	if err != nil {
+		return err
+	}
+	if len(followers) == 0 {
+		return nil
+	}
+
+	// Get all poo seshes from the above followers. They should be started and not ended
+	params := dbx.Params{}
+	conditions := make([]string, 0, len(followers))
+	for i, follower := range followers {
+		key := fmt.Sprintf("follower%d", i)
+		conditions = append(conditions, "poo_profile = {:"+key+"}")
+		params[key] = follower.GetString("follower")
+	}
+	profileFilter := strings.Join(conditions, " || ")
+	poopSeshes, err := app.FindRecordsByFilter("poop_seshes", "( "+profileFilter+" ) && started != null && ended = null", "-started", 100, 0, params)
+	if err != nil {
+		return fmt.Errorf("error getting poo seshes: %w", err)
+	}
+
+	var errs []error
+	for _, pooSesh := range poopSeshes {
+		err := s.Enqueue(app, pooSesh.GetString("poo_profile"), PoopSesh, NotificationData{
+			Title:  "Poop Sesh",
+			Body:   "One of your buddies is also pooping",
+			Screen: "/(protected)/(screens)/chat/" + pooSesh.GetString("poo_profile") + "/" + profileId,
+		}, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", pooSesh.GetString("poo_profile"), err))
+		}
+	}
+	return errors.Join(errs...)
+}
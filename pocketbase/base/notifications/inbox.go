@@ -0,0 +1,143 @@
+package notifications
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// inboxMaxPerPage caps the page size of Inbox.
+const inboxMaxPerPage = 100
+
+// InboxPage is one page of a profile's notifications, newest first.
+type InboxPage struct {
+	Page        int            `json:"page"`
+	PerPage     int            `json:"perPage"`
+	TotalItems  int            `json:"totalItems"`
+	UnreadCount int            `json:"unreadCount"`
+	Items       []*core.Record `json:"items"`
+}
+
+// storeNotification writes the notification to the recipient's inbox
+// through app.
+func storeNotification(app core.App, recipientID string, notificationType NotificationType, data NotificationData, custom *NotificationRecord) (*core.Record, error) {
+	collectionName := "notifications"
+	if custom != nil && custom.CollectionName != "" {
+		collectionName = custom.CollectionName
+	}
+	collection, err := app.FindCachedCollectionByNameOrId(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("poo_profile", recipientID)
+	record.Set("type", notificationType.String())
+	record.Set("title", data.Title)
+	record.Set("body", data.Body)
+	record.Set("screen", data.Screen)
+	record.Set("data", data.Data)
+	if custom != nil {
+		for field, value := range custom.Fields {
+			record.Set(field, value)
+		}
+	}
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// UnreadCount returns how many notifications of the profile are unread.
+func (s *NotificationService) UnreadCount(profileId string) (int, error) {
+	count, err := s.app.CountRecords("notifications", dbx.HashExp{"poo_profile": profileId, "read_at": ""})
+	return int(count), err
+}
+
+// Inbox returns a page of the profile's notifications, only the unread ones
+// if unreadOnly is set. page starts at 1.
+func (s *NotificationService) Inbox(profileId string, unreadOnly bool, page, perPage int) (*InboxPage, error) {
+	page = max(page, 1)
+	if perPage < 1 || perPage > inboxMaxPerPage {
+		perPage = 30
+	}
+
+	filter := dbx.HashExp{"poo_profile": profileId}
+	if unreadOnly {
+		filter["read_at"] = ""
+	}
+
+	total, err := s.app.CountRecords("notifications", filter)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.UnreadCount(profileId)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []*core.Record{}
+	err = s.app.RecordQuery("notifications").
+		AndWhere(filter).
+		OrderBy("created DESC", "id DESC").
+		Limit(int64(perPage)).
+		Offset(int64((page - 1) * perPage)).
+		All(&items)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InboxPage{
+		Page:        page,
+		PerPage:     perPage,
+		TotalItems:  int(total),
+		UnreadCount: unread,
+		Items:       items,
+	}, nil
+}
+
+// MarkRead marks the profile's notification read and returns it. Marking a
+// read notification again keeps its original read date.
+func (s *NotificationService) MarkRead(profileId, notificationId string) (*core.Record, error) {
+	record, err := s.app.FindFirstRecordByFilter(
+		"notifications",
+		"id = {:id} && poo_profile = {:profileId}",
+		dbx.Params{"id": notificationId, "profileId": profileId},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !record.GetDateTime("read_at").IsZero() {
+		return record, nil
+	}
+
+	record.Set("read_at", types.NowDateTime())
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// MarkAllRead marks every unread notification of the profile read and
+// returns how many there were. Records are saved one by one so realtime
+// subscribers see every change.
+func (s *NotificationService) MarkAllRead(profileId string) (int, error) {
+	marked := 0
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		unread, err := txApp.FindAllRecords("notifications", dbx.HashExp{"poo_profile": profileId, "read_at": ""})
+		if err != nil {
+			return err
+		}
+
+		now := types.NowDateTime()
+		for _, record := range unread {
+			record.Set("read_at", now)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+		marked = len(unread)
+		return nil
+	})
+	return marked, err
+}
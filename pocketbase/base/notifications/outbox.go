@@ -0,0 +1,236 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// outboxMaxAttempts is how often a push is tried before it is dead.
+	outboxMaxAttempts = 8
+	// outboxBackoff is the wait before the first retry; it doubles after
+	// every failed attempt up to outboxMaxBackoff, about an hour in total.
+	outboxBackoff    = 30 * time.Second
+	outboxMaxBackoff = 30 * time.Minute
+	// outboxPollInterval is how often the worker looks for due pushes when
+	// nothing wakes it, e.g. for retries or entries queued by the CLI.
+	outboxPollInterval = 15 * time.Second
+	outboxBatchSize    = 50
+)
+
+// Outbox statuses stored in push_outbox.
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxSkipped = "skipped" // pushes of the type are off, or no devices
+	OutboxDead    = "dead"    // gave up; see `notifications replay`
+)
+
+// Enqueue stores the notification in the recipient's inbox and queues its
+// push in the outbox, both in one transaction of app. Pass the transaction
+// of the write that caused the notification: the push is then sent if and
+// only if the write commits, and is retried by the OutboxWorker until Expo
+// takes it.
+func (s *NotificationService) Enqueue(app core.App, recipientID string, notificationType NotificationType, data NotificationData, record *NotificationRecord) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		notification, err := storeNotification(txApp, recipientID, notificationType, data, record)
+		if err != nil {
+			return fmt.Errorf("error storing notification: %w", err)
+		}
+
+		collection, err := txApp.FindCachedCollectionByNameOrId("push_outbox")
+		if err != nil {
+			return err
+		}
+
+		entry := core.NewRecord(collection)
+		entry.Set("poo_profile", recipientID)
+		entry.Set("notification_id", notification.Id)
+		entry.Set("type", notificationType.String())
+		entry.Set("title", data.Title)
+		entry.Set("body", data.Body)
+		entry.Set("screen", data.Screen)
+		entry.Set("data", data.Data)
+		entry.Set("status", OutboxPending)
+		entry.Set("next_attempt", types.NowDateTime())
+		if err := txApp.Save(entry); err != nil {
+			return fmt.Errorf("error queueing push: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeliverOutbox sends every push that is due. Pushes that failed for some
+// devices are retried for those devices with exponential backoff, and
+// marked dead after outboxMaxAttempts attempts, or right away when no device
+// got them and retrying cannot help.
+func (s *NotificationService) DeliverOutbox() error {
+	for {
+		// Attempted entries are either done or due later, so every pass
+		// fetches new ones.
+		due, err := s.app.FindRecordsByFilter(
+			"push_outbox",
+			"status = {:status} && next_attempt <= {:now}",
+			"next_attempt",
+			outboxBatchSize,
+			0,
+			dbx.Params{"status": OutboxPending, "now": types.NowDateTime()},
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range due {
+			if err := s.attempt(entry); err != nil {
+				return err
+			}
+		}
+
+		if len(due) < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+// attempt delivers one outbox entry and records the outcome.
+func (s *NotificationService) attempt(entry *core.Record) error {
+	outcome, err := s.deliver(entry)
+
+	attempts := entry.GetInt("attempts") + 1
+	entry.Set("attempts", attempts)
+	entry.Set("last_error", "")
+	if err != nil {
+		entry.Set("last_error", err.Error())
+	}
+
+	switch {
+	case outcome == pushSent:
+		// Devices that failed for good are left in failed_to and last_error.
+		entry.Set("status", OutboxSent)
+		entry.Set("sent_at", types.NowDateTime())
+	case outcome == pushSkipped:
+		entry.Set("status", OutboxSkipped)
+	case outcome == pushFailed || attempts >= outboxMaxAttempts:
+		log.Printf("Giving up on push %s to profile %s after %d attempts: %v", entry.Id, entry.GetString("poo_profile"), attempts, err)
+		entry.Set("status", OutboxDead)
+	default:
+		entry.Set("next_attempt", types.NowDateTime().Add(outboxRetryDelay(attempts)))
+	}
+	return s.app.Save(entry)
+}
+
+// outboxRetryDelay is the wait after the given number of failed attempts.
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxBackoff
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxBackoff)
+}
+
+// OutboxWorker delivers the queued pushes in the background while the
+// server runs. It is woken whenever a push is queued and committed, and
+// otherwise polls for retries that became due.
+type OutboxWorker struct {
+	service *NotificationService
+	wake    chan struct{}
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// RegisterOutbox returns the outbox worker, started with the server.
+func RegisterOutbox(app *pocketbase.PocketBase) *OutboxWorker {
+	w := &OutboxWorker{
+		service: NewNotificationService(app),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		w.start()
+		return se.Next()
+	})
+
+	// Runs after the transaction commits, so the worker sees the entry.
+	app.OnRecordAfterCreateSuccess("push_outbox").BindFunc(func(e *core.RecordEvent) error {
+		w.Wake()
+		return e.Next()
+	})
+
+	return w
+}
+
+func (w *OutboxWorker) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return
+	}
+	w.started = true
+	go w.run()
+}
+
+// Wake makes the worker look for due pushes now. It never blocks.
+func (w *OutboxWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *OutboxWorker) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.service.DeliverOutbox(); err != nil {
+			log.Printf("Error delivering push outbox: %v", err)
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown stops the worker and waits for the pushes it is sending, or for
+// ctx to be done. Whatever is still pending is sent after the next start.
+func (w *OutboxWorker) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	started := w.started
+	if started {
+		select {
+		case <-w.stop:
+		default:
+			close(w.stop)
+		}
+	}
+	w.mu.Unlock()
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
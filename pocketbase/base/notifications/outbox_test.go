@@ -0,0 +1,252 @@
+package notifications
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"loglog/internal/apptest"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	phoneToken  = "ExponentPushToken[phone]"
+	tabletToken = "ExponentPushToken[tablet]"
+)
+
+func newOutboxTest(t *testing.T) (*fakeExpo, *NotificationService, *core.Record) {
+	expo := newFakeExpo(t)
+	app := apptest.NewApp(t)
+	service := NewNotificationService(app)
+	profile := apptest.NewProfile(t, app, "pusher", nil)
+	for _, token := range []string{phoneToken, tabletToken} {
+		if _, err := service.RegisterDevice(profile.Id, DeviceRegistration{Token: token}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return expo, service, profile
+}
+
+// deliverDue makes every pending entry due and runs the outbox once.
+func deliverDue(t *testing.T, service *NotificationService) {
+	t.Helper()
+	_, err := service.app.DB().NewQuery("UPDATE push_outbox SET next_attempt = {:now} WHERE status = 'pending'").
+		Bind(map[string]any{"now": types.NowDateTime().String()}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeliverOutbox(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func onlyEntry(t *testing.T, service *NotificationService) *core.Record {
+	t.Helper()
+	entries, err := service.app.FindAllRecords("push_outbox")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("want one outbox entry, got %d (%v)", len(entries), err)
+	}
+	return entries[0]
+}
+
+func TestOutboxSendsToEveryDevice(t *testing.T) {
+	expo, service, profile := newOutboxTest(t)
+
+	if err := service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sent := expo.sentTokens(); len(sent) != 0 {
+		t.Fatalf("sent before the worker ran: %v", sent)
+	}
+
+	deliverDue(t, service)
+	if sent := expo.sentTokens(); len(sent) != 2 {
+		t.Fatalf("sent to %v, want both devices", sent)
+	}
+	entry := onlyEntry(t, service)
+	if entry.GetString("status") != OutboxSent || entry.GetInt("attempts") != 1 {
+		t.Errorf("status %s after %d attempts, want sent after 1", entry.GetString("status"), entry.GetInt("attempts"))
+	}
+}
+
+func TestOutboxRetriesOnlyFailedDevices(t *testing.T) {
+	expo, service, profile := newOutboxTest(t)
+	expo.tickets[tabletToken] = errorTicket("MessageRateExceeded")
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	deliverDue(t, service)
+	expo.sentTokens()
+
+	entry := onlyEntry(t, service)
+	if entry.GetString("status") != OutboxPending {
+		t.Fatalf("status %s, want pending while the tablet is rate limited", entry.GetString("status"))
+	}
+	if !entry.GetDateTime("next_attempt").After(types.NowDateTime()) {
+		t.Error("retry is not backed off")
+	}
+
+	delete(expo.tickets, tabletToken)
+	deliverDue(t, service)
+	if sent := expo.sentTokens(); !slices.Equal(sent, []string{tabletToken}) {
+		t.Errorf("retry sent to %v, want only the tablet", sent)
+	}
+	if entry := onlyEntry(t, service); entry.GetString("status") != OutboxSent {
+		t.Errorf("status %s, want sent", entry.GetString("status"))
+	}
+}
+
+func TestOutboxRetriesFailedRequestsUntilDead(t *testing.T) {
+	expo, service, profile := newOutboxTest(t)
+	expo.failRequests = outboxMaxAttempts
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	for i := 1; i <= outboxMaxAttempts; i++ {
+		deliverDue(t, service)
+		entry := onlyEntry(t, service)
+		want := OutboxPending
+		if i == outboxMaxAttempts {
+			want = OutboxDead
+		}
+		if entry.GetString("status") != want || entry.GetInt("attempts") != i {
+			t.Fatalf("attempt %d: status %s, want %s", i, entry.GetString("status"), want)
+		}
+	}
+
+	// Expo is back: replaying sends it.
+	command := NewCommand(service.app)
+	command.SetOut(&bytes.Buffer{})
+	command.SetArgs([]string{"replay"})
+	if err := command.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	deliverDue(t, service)
+	if entry := onlyEntry(t, service); entry.GetString("status") != OutboxSent {
+		t.Errorf("status %s after replay, want sent", entry.GetString("status"))
+	}
+}
+
+func TestOutboxDeadWhenRetryingCannotHelp(t *testing.T) {
+	expo, service, profile := newOutboxTest(t)
+	expo.tickets[phoneToken] = errorTicket("MessageTooBig")
+	expo.tickets[tabletToken] = errorTicket("MessageTooBig")
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	deliverDue(t, service)
+
+	entry := onlyEntry(t, service)
+	if entry.GetString("status") != OutboxDead || entry.GetInt("attempts") != 1 {
+		t.Errorf("status %s after %d attempts, want dead after 1", entry.GetString("status"), entry.GetInt("attempts"))
+	}
+}
+
+func TestOutboxPartialPermanentFailureIsSent(t *testing.T) {
+	expo, service, profile := newOutboxTest(t)
+	expo.tickets[tabletToken] = errorTicket("DeviceNotRegistered")
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Hi"}, nil)
+	deliverDue(t, service)
+
+	entry := onlyEntry(t, service)
+	if entry.GetString("status") != OutboxSent || entry.GetString("last_error") == "" {
+		t.Errorf("status %s (%q), want sent with the tablet's error", entry.GetString("status"), entry.GetString("last_error"))
+	}
+	tablet, _ := service.app.FindFirstRecordByData("push_devices", "token", tabletToken)
+	if tablet.GetBool("active") {
+		t.Error("unregistered tablet is still active")
+	}
+}
+
+func TestOutboxSkipped(t *testing.T) {
+	expo, service, profile := newOutboxTest(t)
+	other := apptest.NewProfile(t, service.app, "deviceless", nil)
+	err := service.SetPreferences(profile.Id, []Preference{{Type: Achievement, Channel: ChannelPush, Enabled: false}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service.SendPushNotification(profile.Id, Achievement, NotificationData{Title: "Muted"}, nil)
+	service.SendPushNotification(other.Id, Achievement, NotificationData{Title: "Nowhere"}, nil)
+	deliverDue(t, service)
+
+	if sent := expo.sentTokens(); len(sent) != 0 {
+		t.Errorf("sent to %v", sent)
+	}
+	entries, _ := service.app.FindAllRecords("push_outbox")
+	for _, entry := range entries {
+		if entry.GetString("status") != OutboxSkipped {
+			t.Errorf("%s: status %s, want skipped", entry.GetString("title"), entry.GetString("status"))
+		}
+	}
+	// Both still land in the inbox.
+	if n, _ := service.app.CountRecords("notifications"); n != 2 {
+		t.Errorf("%d notifications in the inboxes, want 2", n)
+	}
+}
+
+func TestEnqueueRollsBackWithTheWrite(t *testing.T) {
+	_, service, profile := newOutboxTest(t)
+
+	err := service.app.RunInTransaction(func(txApp core.App) error {
+		if err := service.Enqueue(txApp, profile.Id, Achievement, NotificationData{Title: "Hi"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("want the rollback error")
+	}
+	for _, collection := range []string{"push_outbox", "notifications"} {
+		if n, _ := service.app.CountRecords(collection); n != 0 {
+			t.Errorf("%d %s records after rollback", n, collection)
+		}
+	}
+}
+
+func TestBuddyPushesDoNotHoldUpTheSesh(t *testing.T) {
+	newFakeExpo(t)
+	app := apptest.NewApp(t)
+	RegisterHooks(app)
+	pooper := apptest.NewProfile(t, app, "pooper", nil)
+	buddy := apptest.NewProfile(t, app, "buddy", map[string]any{"expo_push_token": "ExponentPushToken[buddy]"})
+
+	follows, _ := app.FindCollectionByNameOrId("follows")
+	follow := core.NewRecord(follows)
+	follow.Set("follower", buddy.Id)
+	follow.Set("following", pooper.Id)
+	follow.Set("status", "approved")
+	if err := app.Save(follow); err != nil {
+		t.Fatal(err)
+	}
+	startSesh(t, app, buddy)
+
+	startSesh(t, app, pooper)
+	if n, _ := app.CountRecords("push_outbox"); n != 1 {
+		t.Fatalf("%d pushes queued, want one for the buddy", n)
+	}
+
+	// Queueing fails, the sesh is saved anyway.
+	outbox, _ := app.FindCollectionByNameOrId("push_outbox")
+	if err := app.Delete(outbox); err != nil {
+		t.Fatal(err)
+	}
+	sesh := startSesh(t, app, pooper)
+	if _, err := app.FindRecordById("poop_seshes", sesh.Id); err != nil {
+		t.Errorf("sesh was not saved: %v", err)
+	}
+}
+
+func startSesh(t *testing.T, app core.App, profile *core.Record) *core.Record {
+	t.Helper()
+	seshes, _ := app.FindCollectionByNameOrId("poop_seshes")
+	sesh := core.NewRecord(seshes)
+	sesh.Set("user", profile.GetString("user"))
+	sesh.Set("poo_profile", profile.Id)
+	sesh.Set("started", types.NowDateTime())
+	if err := app.Save(sesh); err != nil {
+		t.Fatal(err)
+	}
+	return sesh
+}
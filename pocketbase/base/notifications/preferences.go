@@ -0,0 +1,141 @@
+package notifications
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Channel is a way a notification reaches the user.
+type Channel string
+
+const (
+	ChannelPush Channel = "push"
+)
+
+// Types and Channels list what preferences can be set for.
+var (
+	Types    = []NotificationType{PoopSesh, Achievement}
+	Channels = []Channel{ChannelPush}
+)
+
+// defaultPreferences apply when a profile has no preference row for a type
+// and channel. Anything missing here is enabled.
+var defaultPreferences = map[NotificationType]map[Channel]bool{
+	PoopSesh:    {ChannelPush: true},
+	Achievement: {ChannelPush: true},
+}
+
+func defaultEnabled(notificationType NotificationType, channel Channel) bool {
+	enabled, ok := defaultPreferences[notificationType][channel]
+	return enabled || !ok
+}
+
+// Preference is whether one notification type is sent over one channel.
+type Preference struct {
+	Type    NotificationType `json:"type"`
+	Channel Channel          `json:"channel"`
+	Enabled bool             `json:"enabled"`
+	Default bool             `json:"default"` // no preference stored, Enabled is the default
+}
+
+// IsEnabled reports whether the profile wants notifications of the type over
+// the channel.
+func (s *NotificationService) IsEnabled(profileId string, notificationType NotificationType, channel Channel) (bool, error) {
+	record, err := s.app.FindFirstRecordByFilter(
+		"notification_preferences",
+		"poo_profile = {:profileId} && type = {:type} && channel = {:channel}",
+		dbx.Params{"profileId": profileId, "type": notificationType.String(), "channel": string(channel)},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultEnabled(notificationType, channel), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return record.GetBool("enabled"), nil
+}
+
+// Preferences returns the profile's preference for every type and channel,
+// with defaults filled in.
+func (s *NotificationService) Preferences(profileId string) ([]Preference, error) {
+	records, err := s.app.FindAllRecords("notification_preferences", dbx.HashExp{"poo_profile": profileId})
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[Preference]bool, len(records))
+	for _, r := range records {
+		key := Preference{Type: NotificationType(r.GetString("type")), Channel: Channel(r.GetString("channel"))}
+		stored[key] = r.GetBool("enabled")
+	}
+
+	preferences := make([]Preference, 0, len(Types)*len(Channels))
+	for _, t := range Types {
+		for _, c := range Channels {
+			p := Preference{Type: t, Channel: c}
+			enabled, ok := stored[p]
+			if !ok {
+				enabled = defaultEnabled(t, c)
+			}
+			p.Enabled, p.Default = enabled, !ok
+			preferences = append(preferences, p)
+		}
+	}
+	return preferences, nil
+}
+
+// ValidatePreferences checks that every preference names a known type and
+// channel.
+func ValidatePreferences(preferences []Preference) error {
+	for i, p := range preferences {
+		if !slices.Contains(Types, p.Type) {
+			return fmt.Errorf("%d: unknown notification type %q", i, p.Type)
+		}
+		if !slices.Contains(Channels, p.Channel) {
+			return fmt.Errorf("%d: unknown notification channel %q", i, p.Channel)
+		}
+	}
+	return nil
+}
+
+// SetPreferences stores the given preferences for the profile in one
+// transaction. Types and channels not listed are left unchanged.
+func (s *NotificationService) SetPreferences(profileId string, preferences []Preference) error {
+	if err := ValidatePreferences(preferences); err != nil {
+		return err
+	}
+
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		collection, err := txApp.FindCachedCollectionByNameOrId("notification_preferences")
+		if err != nil {
+			return err
+		}
+
+		for _, p := range preferences {
+			record, err := txApp.FindFirstRecordByFilter(
+				collection,
+				"poo_profile = {:profileId} && type = {:type} && channel = {:channel}",
+				dbx.Params{"profileId": profileId, "type": p.Type.String(), "channel": string(p.Channel)},
+			)
+			if errors.Is(err, sql.ErrNoRows) {
+				record = core.NewRecord(collection)
+				record.Set("poo_profile", profileId)
+				record.Set("type", p.Type.String())
+				record.Set("channel", string(p.Channel))
+			} else if err != nil {
+				return err
+			}
+
+			record.Set("enabled", p.Enabled)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
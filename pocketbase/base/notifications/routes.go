@@ -0,0 +1,189 @@
+package notifications
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// preferencesResponse lists every preference of the user.
+type preferencesResponse struct {
+	Preferences []Preference `json:"preferences"`
+}
+
+// preferencesRequest is the body of PATCH /api/notifications/preferences.
+type preferencesRequest struct {
+	Preferences []struct {
+		Type    NotificationType `json:"type"`
+		Channel Channel          `json:"channel"`
+		Enabled *bool            `json:"enabled"`
+	} `json:"preferences"`
+}
+
+// RegisterRoutes binds the notification API routes.
+func RegisterRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	// The authenticated user's inbox, newest first, with the unread count for
+	// the badge. ?unread=true lists unread notifications only; ?page and
+	// ?perPage (at most 100) page through it.
+	se.Router.GET("/api/notifications", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		query := e.Request.URL.Query()
+		unreadOnly, _ := strconv.ParseBool(query.Get("unread"))
+		page, _ := strconv.Atoi(query.Get("page"))
+		perPage, _ := strconv.Atoi(query.Get("perPage"))
+
+		inbox, err := NewNotificationService(app).Inbox(profile.Id, unreadOnly, page, perPage)
+		if err != nil {
+			return e.InternalServerError("Failed to load notifications.", err)
+		}
+
+		return e.JSON(http.StatusOK, inbox)
+	}).Bind(apis.RequireAuth("users"))
+
+	// Marks one of the user's notifications read and returns it.
+	se.Router.POST("/api/notifications/{id}/read", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		notification, err := NewNotificationService(app).MarkRead(profile.Id, e.Request.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return e.NotFoundError("Notification not found.", err)
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to mark notification read.", err)
+		}
+
+		return e.JSON(http.StatusOK, notification)
+	}).Bind(apis.RequireAuth("users"))
+
+	// Marks every unread notification of the user read.
+	se.Router.POST("/api/notifications/read-all", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		marked, err := NewNotificationService(app).MarkAllRead(profile.Id)
+		if err != nil {
+			return e.InternalServerError("Failed to mark notifications read.", err)
+		}
+
+		return e.JSON(http.StatusOK, map[string]int{"marked": marked})
+	}).Bind(apis.RequireAuth("users"))
+
+	// Notification preferences of the authenticated user, defaults included.
+	se.Router.GET("/api/notifications/preferences", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		preferences, err := NewNotificationService(app).Preferences(profile.Id)
+		if err != nil {
+			return e.InternalServerError("Failed to load notification preferences.", err)
+		}
+
+		return e.JSON(http.StatusOK, preferencesResponse{Preferences: preferences})
+	}).Bind(apis.RequireAuth("users"))
+
+	// Updates the listed preferences and returns all of them.
+	se.Router.PATCH("/api/notifications/preferences", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		var body preferencesRequest
+		if err := e.BindBody(&body); err != nil {
+			return e.BadRequestError("Invalid request body.", err)
+		}
+
+		updates := make([]Preference, len(body.Preferences))
+		for i, p := range body.Preferences {
+			if p.Enabled == nil {
+				return apis.NewBadRequestError("Invalid notification preferences.", validation.Errors{
+					"preferences": validation.NewError("validation_invalid_preferences", fmt.Sprintf("%d: enabled is required", i)),
+				})
+			}
+			updates[i] = Preference{Type: p.Type, Channel: p.Channel, Enabled: *p.Enabled}
+		}
+		if err := ValidatePreferences(updates); err != nil {
+			return apis.NewBadRequestError("Invalid notification preferences.", validation.Errors{
+				"preferences": validation.NewError("validation_invalid_preferences", err.Error()),
+			})
+		}
+
+		service := NewNotificationService(app)
+		if err := service.SetPreferences(profile.Id, updates); err != nil {
+			return e.InternalServerError("Failed to save notification preferences.", err)
+		}
+
+		preferences, err := service.Preferences(profile.Id)
+		if err != nil {
+			return e.InternalServerError("Failed to load notification preferences.", err)
+		}
+
+		return e.JSON(http.StatusOK, preferencesResponse{Preferences: preferences})
+	}).Bind(apis.RequireAuth("users"))
+
+	// Registers a device for pushes, or refreshes its details and last seen
+	// date. Clients call it on every app start.
+	se.Router.POST("/api/push-devices", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		var body DeviceRegistration
+		if err := e.BindBody(&body); err != nil {
+			return e.BadRequestError("Invalid request body.", err)
+		}
+		if err := body.Validate(); err != nil {
+			return apis.NewBadRequestError("Invalid push device.", validation.Errors{
+				"token": validation.NewError("validation_invalid_push_device", err.Error()),
+			})
+		}
+
+		device, err := NewNotificationService(app).RegisterDevice(profile.Id, body)
+		if err != nil {
+			return e.InternalServerError("Failed to register push device.", err)
+		}
+
+		return e.JSON(http.StatusOK, device)
+	}).Bind(apis.RequireAuth("users"))
+
+	// Stops pushes to a device, e.g. on logout.
+	se.Router.POST("/api/push-devices/unregister", func(e *core.RequestEvent) error {
+		profile, err := app.FindFirstRecordByFilter("poo_profiles", "user = {:userId}", dbx.Params{"userId": e.Auth.Id})
+		if err != nil {
+			return e.NotFoundError("Poo profile not found.", err)
+		}
+
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := e.BindBody(&body); err != nil {
+			return e.BadRequestError("Invalid request body.", err)
+		}
+
+		if err := NewNotificationService(app).UnregisterDevice(profile.Id, body.Token); err != nil {
+			return e.InternalServerError("Failed to unregister push device.", err)
+		}
+
+		return e.NoContent(http.StatusNoContent)
+	}).Bind(apis.RequireAuth("users"))
+}
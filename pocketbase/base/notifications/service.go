@@ -1,11 +1,16 @@
 package notifications
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"slices"
+	"time"
 
-	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
 )
 
@@ -24,12 +29,34 @@ const (
 type NotificationService struct {
 	app    *pocketbase.PocketBase
 	client *expo.PushClient
+
+	// Receipts are fetched without the SDK, which has no receipts API.
+	expoHost    string
+	accessToken string
+	http        *http.Client
 }
 
+// NewNotificationService sends pushes through Expo. EXPO_HOST overrides the
+// Expo host, e.g. to point at a fake server in tests, and EXPO_ACCESS_TOKEN
+// is required when the Expo project has enhanced push security enabled.
 func NewNotificationService(app *pocketbase.PocketBase) *NotificationService {
+	host := os.Getenv("EXPO_HOST")
+	if host == "" {
+		host = expo.DefaultHost
+	}
+	accessToken := os.Getenv("EXPO_ACCESS_TOKEN")
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+
 	return &NotificationService{
-		app:    app,
-		client: expo.NewPushClient(nil),
+		app: app,
+		client: expo.NewPushClient(&expo.ClientConfig{
+			Host:        host,
+			AccessToken: accessToken,
+			HTTPClient:  httpClient,
+		}),
+		expoHost:    host,
+		accessToken: accessToken,
+		http:        httpClient,
 	}
 }
 
@@ -42,62 +69,170 @@ type NotificationData struct {
 
 // NotificationRecord represents how the notification should be stored in the database
 type NotificationRecord struct {
-	CollectionName string                 // The name of the collection to store the notification in
-	Fields         map[string]interface{} // The fields to store in the notification record
+	CollectionName string                 // The name of the collection to store the notification in, notifications if empty
+	Fields         map[string]interface{} // Fields to store on top of the recipient, type, title, body, screen and data
 }
 
-// SendPushNotification sends a push notification to a specific user and optionally records it in the database
+// SendPushNotification stores a notification in the recipient's inbox and
+// queues its push, see Enqueue. Use Enqueue instead when the notification is
+// caused by a write made in a transaction. record customizes the stored
+// notification and may be nil.
 func (s *NotificationService) SendPushNotification(recipientID string, notificationType NotificationType, data NotificationData, record *NotificationRecord) error {
-	// Get the user's expo push token
-	pooProfile, err := s.app.FindFirstRecordByFilter("poo_profiles", "id = {:pooProfileId}", dbx.Params{"pooProfileId": recipientID})
+	return s.Enqueue(s.app, recipientID, notificationType, data, record)
+}
+
+// pushOutcome is what became of an attempt to deliver an outbox entry.
+type pushOutcome int
+
+const (
+	// pushSent: every device got the push or failed for good, and at least
+	// one got it.
+	pushSent pushOutcome = iota
+	// pushSkipped: the recipient turned the push off or has no devices.
+	pushSkipped
+	// pushRetry: some devices are worth another attempt.
+	pushRetry
+	// pushFailed: no device got the push and retrying cannot help.
+	pushFailed
+)
+
+// deliver pushes a queued notification to the recipient's devices unless
+// they turned pushes of its type off. Devices are recorded on the entry in
+// sent_to once Expo accepts their message and in failed_to once retrying
+// cannot help, so a later attempt only sends to the rest. Failed requests
+// and rate limited messages are worth retrying; other errors are not.
+func (s *NotificationService) deliver(entry *core.Record) (pushOutcome, error) {
+	recipientID := entry.GetString("poo_profile")
+	notificationType := NotificationType(entry.GetString("type"))
+
+	// Both are empty before the first attempt.
+	var sentTo, failedTo []string
+	entry.UnmarshalJSONField("sent_to", &sentTo)
+	entry.UnmarshalJSONField("failed_to", &failedTo)
+	// done is what an attempt that sends nothing more ends as.
+	done := func() pushOutcome {
+		if len(sentTo) > 0 {
+			return pushSent
+		}
+		if len(failedTo) > 0 {
+			return pushFailed
+		}
+		return pushSkipped
+	}
+
+	enabled, err := s.ShouldSendNotification(recipientID, notificationType)
 	if err != nil {
-		return fmt.Errorf("error getting player profile: %w", err)
+		return pushRetry, fmt.Errorf("error checking notification preferences: %w", err)
+	}
+	if !enabled {
+		if len(sentTo) > 0 {
+			return pushSent, nil
+		}
+		return pushSkipped, nil
 	}
 
-	expoPushToken, err := expo.NewExponentPushToken(pooProfile.Get("expo_push_token").(string))
+	all, err := s.pushDevices(recipientID)
 	if err != nil {
-		return fmt.Errorf("error creating push token: %w", err)
+		return pushRetry, fmt.Errorf("error getting push devices: %w", err)
+	}
+	devices := make([]pushDevice, 0, len(all))
+	for _, device := range all {
+		if !slices.Contains(sentTo, string(device.token)) && !slices.Contains(failedTo, string(device.token)) {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		return done(), nil
 	}
 
 	// Merge provided data with screen navigation data
-	notificationData := data.Data
-	if notificationData == nil {
-		notificationData = make(map[string]string)
+	notificationData := make(map[string]string)
+	if err := entry.UnmarshalJSONField("data", &notificationData); err != nil {
+		return pushFailed, fmt.Errorf("error reading notification data: %w", err)
+	}
+	if screen := entry.GetString("screen"); screen != "" {
+		notificationData["screen"] = screen
 	}
-	if data.Screen != "" {
-		notificationData["screen"] = data.Screen
+	// Lets the app mark the notification read when it is opened.
+	notificationId := entry.GetString("notification_id")
+	notificationData["notificationId"] = notificationId
+
+	// The badge shows the unread inbox count, this notification included.
+	badge, err := s.UnreadCount(recipientID)
+	if err != nil {
+		log.Printf("Error counting unread notifications of profile %s: %v", recipientID, err)
 	}
 
-	// Send the notification
-	response, err := s.client.Publish(
-		&expo.PushMessage{
-			To:       []expo.ExponentPushToken{expoPushToken},
-			Body:     data.Body,
+	// One message per device, sent in as few requests as Expo allows. A
+	// single message addressed to every token would get one ticket per
+	// token back, which the SDK rejects.
+	messages := make([]expo.PushMessage, len(devices))
+	for i, device := range devices {
+		messages[i] = expo.PushMessage{
+			To:       []expo.ExponentPushToken{device.token},
+			Body:     entry.GetString("body"),
 			Data:     notificationData,
 			Sound:    "default",
-			Title:    data.Title,
+			Title:    entry.GetString("title"),
 			Priority: expo.DefaultPriority,
-		},
-	)
-
-	if err != nil {
-		return fmt.Errorf("error publishing notification: %w", err)
+			Badge:    badge,
+		}
 	}
 
-	// Validate response
-	if err := response.ValidateResponse(); err != nil {
-		log.Printf("Failed to send notification to %v: %v", expoPushToken, err)
-		return err
+	// Every message's ticket is stored so the receipt can be checked later,
+	// see CheckReceipts.
+	delivery := newDelivery(notificationId, recipientID, notificationType, entry.GetString("title"))
+
+	var (
+		errs  []error
+		retry bool
+	)
+	for start := 0; start < len(messages); start += expoBatchSize {
+		end := min(start+expoBatchSize, len(messages))
+		responses, err := s.client.PublishMultiple(messages[start:end])
+		if err != nil {
+			err = fmt.Errorf("error publishing notification: %w", err)
+			for _, device := range devices[start:end] {
+				s.recordDelivery(delivery, device, expo.PushResponse{Status: "error", Message: err.Error()})
+			}
+			errs = append(errs, err)
+			retry = true
+			continue
+		}
+
+		// Validate responses
+		for i, response := range responses {
+			device := devices[start+i]
+			s.recordDelivery(delivery, device, response)
+			if err := response.ValidateResponse(); err != nil {
+				log.Printf("Failed to send notification to %s of profile %s: %v", device, recipientID, err)
+				errs = append(errs, err)
+				switch response.Details["error"] {
+				case expo.ErrorMessageRateExceeded:
+					retry = true
+					continue
+				case expo.ErrorDeviceNotRegistered:
+					if err := s.disableToken(device.id, string(device.token)); err != nil {
+						log.Printf("Error disabling %s of profile %s: %v", device, recipientID, err)
+					}
+				}
+				failedTo = append(failedTo, string(device.token))
+				continue
+			}
+			sentTo = append(sentTo, string(device.token))
+		}
 	}
 
-	return nil
+	entry.Set("sent_to", sentTo)
+	entry.Set("failed_to", failedTo)
+	if retry {
+		return pushRetry, errors.Join(errs...)
+	}
+	return done(), errors.Join(errs...)
 }
 
-// Should send notification checks if a user should receive a notification. It users the player_notification_settings collection to check if the user should receive the notification.
+// ShouldSendNotification checks the recipient's notification preferences
+// for a push of the given type.
 func (s *NotificationService) ShouldSendNotification(recipientID string, notificationType NotificationType) (bool, error) {
-	playerSettings, err := s.app.FindFirstRecordByFilter("player_notification_settings", "player_profile_id = {:recipientId} && notification_type = {:notificationType} && channel = 'push'", dbx.Params{"recipientId": recipientID, "notificationType": notificationType.String()})
-	if err != nil {
-		return false, err
-	}
-	return playerSettings.Get("enabled").(bool), nil
-}
\ No newline at end of file
+	return s.IsEnabled(recipientID, notificationType, ChannelPush)
+}